@@ -2,6 +2,8 @@ package CommitDAG
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash"
 	"math"
@@ -9,6 +11,9 @@ import (
 	"strings"
 )
 
+// ErrNodeNotInDAG is returned when a node passed to the DAG belongs to another DAG.
+var ErrNodeNotInDAG = errors.New("CommitDAG: node is not in this DAG")
+
 type Content interface {
 	CalculateHash() ([]byte, error)
 	Equals(other Content) (bool, error)
@@ -22,21 +27,23 @@ type CommitDAG struct {
 	Levels       map[int][]*Node
 	Leafs        []*Node
 	hashStrategy func() hash.Hash
+	frontier     []*Node // nodes no other node depends on yet, in Number order
 }
 
 type Node struct {
-	DAG     *CommitDAG
-	Parents []*Node
-	Left    *Node
-	Right   *Node
-	leaf    bool
-	Hash    []byte
-	C       Content
-	Data    string
-	Index   string
-	Number  int
-	done    bool
-	verify  []byte
+	DAG         *CommitDAG
+	Parents     []*Node
+	Left        *Node
+	Right       *Node
+	leaf        bool
+	Hash        []byte // label of the node, see nodeLabel
+	C           Content
+	ContentHash []byte
+	Data        string
+	Index       string
+	Number      int
+	done        bool
+	verify      []byte
 }
 
 // This function Create a new DAG pointer and push first node as initialized node in it.
@@ -49,18 +56,17 @@ func NewDAGGenesis(cs Content) (*CommitDAG, error) {
 		return nil, err
 	}
 	nodes = append(nodes, &Node{ // Assign data to new node
-		Hash:   hash,         // Field of Hash in node structure
-		C:      cs,           // Field of Content in node structure
-		Data:   cs.GetData(), // Field of Data in node structure
-		leaf:   true,         // Is this node leaf?
-		DAG:    t,            // Pointer of DAG of this node
-		Index:  "0",          // Index of node in binary string based of binary DAG
-		done:   true,         // Is calculation completely Done?
-		Number: 1,            // Traversing Number of Node - first node is 1
+		ContentHash: hash,         // Field of Content hash in node structure
+		C:           cs,           // Field of Content in node structure
+		Data:        cs.GetData(), // Field of Data in node structure
+		leaf:        true,         // Is this node leaf?
+		DAG:         t,            // Pointer of DAG of this node
+		Index:       "0",          // Index of node in binary string based of binary DAG
+		done:        true,         // Is calculation completely Done?
+		Number:      1,            // Traversing Number of Node - first node is 1
 	})
 	t.Root = nodes[0]
 	t.Nodes = nodes
-	t.dagRoot = hash
 	emptyNode := &Node{DAG: t}
 	level := make(map[int][]*Node)
 	level[0] = append(level[0], emptyNode)
@@ -70,6 +76,8 @@ func NewDAGGenesis(cs Content) (*CommitDAG, error) {
 	if !setParentsToNode(t.Nodes[0], t) {
 		return nil, err
 	}
+	relabel(t.Nodes[0], t)
+	addToFrontier(t.Nodes[0], t)
 	return t, nil
 }
 
@@ -85,14 +93,14 @@ func AddNewLeafToDAG(cs Content, t *CommitDAG, depth int) (*Node, error) {
 		return nil, err
 	}
 	newNode := &Node{
-		Hash:   hash,             // Field of Hash in node structure
-		C:      cs,               // Field of Content in node structure
-		Data:   cs.GetData(),     // Field of Data in node structure
-		leaf:   true,             // Is this node leaf?
-		DAG:    t,                // Pointer of DAG of this node
-		Index:  index,            // Index of node in binary string based of binary DAG
-		Number: traversingNumber, // Traversing Number of Node
-		done:   true,             // Is calculation completely Done?
+		ContentHash: hash,             // Field of Content hash in node structure
+		C:           cs,               // Field of Content in node structure
+		Data:        cs.GetData(),     // Field of Data in node structure
+		leaf:        true,             // Is this node leaf?
+		DAG:         t,                // Pointer of DAG of this node
+		Index:       index,            // Index of node in binary string based of binary DAG
+		Number:      traversingNumber, // Traversing Number of Node
+		done:        true,             // Is calculation completely Done?
 	}
 	t.Nodes = append(t.Nodes, newNode)
 	t.Levels[depth] = append(t.Levels[depth], newNode) // Add new leaf to leafs level nodes
@@ -100,6 +108,8 @@ func AddNewLeafToDAG(cs Content, t *CommitDAG, depth int) (*Node, error) {
 		fmt.Printf("error in adding parent to %s\n", newNode.Data)
 		return nil, err
 	}
+	relabel(newNode, t)
+	addToFrontier(newNode, t)
 	return t.Root, nil
 }
 
@@ -111,13 +121,13 @@ func AddIntermediateNode(cs Content, t *CommitDAG, depth int, index string) (*No
 		return nil, err
 	}
 	newNode := &Node{
-		Hash:   hash,
-		C:      cs,
-		Data:   cs.GetData(),
-		leaf:   false,
-		DAG:    t,
-		Number: traversingNumber,
-		Index:  index,
+		ContentHash: hash,
+		C:           cs,
+		Data:        cs.GetData(),
+		leaf:        false,
+		DAG:         t,
+		Number:      traversingNumber,
+		Index:       index,
 	}
 	t.Nodes = append(t.Nodes, newNode)
 	newNodeLevel := len(index)
@@ -126,6 +136,8 @@ func AddIntermediateNode(cs Content, t *CommitDAG, depth int, index string) (*No
 		fmt.Printf("error in adding parent to %s\n", newNode.Data)
 		return nil, err
 	}
+	relabel(newNode, t)
+	addToFrontier(newNode, t)
 	return t.Root, nil
 }
 
@@ -173,9 +185,150 @@ func AddNodeToDAG(cs Content, t *CommitDAG) ([]byte, *CommitDAG, error) {
 	return t.dagRoot, t, nil
 }
 
-// This function update the state of node hash be calling
-func Update(cs Content, node *Node, t *CommitDAG) {
+// This function replace the content of node by cs, recompute its label and then the label
+// of every node that depends on it through Parents, Left or Right. Nodes are visited in
+// traversing Number order, so a node is relabelled only after everything it depends on.
+// It returns the touched nodes, starting with node itself.
+func Update(cs Content, node *Node, t *CommitDAG) ([]*Node, error) {
+	if node == nil || node.DAG != t || node.Number < 1 || node.Number > len(t.Nodes) || t.Nodes[node.Number-1] != node {
+		return nil, ErrNodeNotInDAG
+	}
+	hash, err := cs.CalculateHash()
+	if err != nil {
+		return nil, err
+	}
+	node.C = cs
+	node.Data = cs.GetData()
+	node.ContentHash = hash
+	relabel(node, t)
+	touched := []*Node{node}
+	changed := map[*Node]bool{node: true}
+	for _, n := range t.Nodes[node.Number:] {
+		if !dependsOn(n, changed) {
+			continue
+		}
+		relabel(n, t)
+		touched = append(touched, n)
+		changed[n] = true
+	}
+	refreshRoot(t)
+	return touched, nil
+}
+
+// This function report if node n has a Parent, Left or Right child in set. The first
+// node is its own parent, which is not a dependency.
+func dependsOn(n *Node, set map[*Node]bool) bool {
+	if set[n.Left] || set[n.Right] {
+		return true
+	}
+	for _, p := range n.Parents {
+		if p != n && set[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// This function recompute the label of node n from its place, its content hash and the
+// labels of the nodes it depends on, and store it in n.Hash.
+func relabel(n *Node, t *CommitDAG) {
+	height, position := nodePlace(n, t)
+	n.Hash = nodeLabel(t.hashStrategy, height, position, n.ContentHash, dependencyLabels(n))
+}
+
+// This function return the place of node n independently of the depth of the DAG: its
+// height above the leafs and the value of its binary Index. Indexes are padded with
+// zeros when the DAG gets deeper, which changes neither, so labels stay valid.
+func nodePlace(n *Node, t *CommitDAG) (int, uint64) {
+	position, _ := strconv.ParseUint(n.Index, 2, 64)
+	return len(t.Nodes[0].Index) - len(n.Index), position
+}
+
+// This function return the labels a node label is computed over: Left and Right for an
+// intermediate node, Parents for a leaf. The first node is its own parent and has none.
+func dependencyLabels(n *Node) [][]byte {
+	var labels [][]byte
+	if !n.leaf {
+		for _, c := range []*Node{n.Left, n.Right} {
+			if c != nil {
+				labels = append(labels, c.Hash)
+			}
+		}
+		return labels
+	}
+	for _, p := range n.Parents {
+		if p != n {
+			labels = append(labels, p.Hash)
+		}
+	}
+	return labels
+}
+
+// This function compute a node label in the style of Cohen–Pietrzak proofs of sequential
+// work: H(height || position || content hash || labels), each field prefixed by its length.
+func nodeLabel(hashStrategy func() hash.Hash, height int, position uint64, contentHash []byte, labels [][]byte) []byte {
+	h := hashStrategy()
+	var place [16]byte
+	binary.BigEndian.PutUint64(place[:8], uint64(height))
+	binary.BigEndian.PutUint64(place[8:], position)
+	writeField(h, place[:])
+	writeField(h, contentHash)
+	for _, l := range labels {
+		writeField(h, l)
+	}
+	return h.Sum(nil)
+}
+
+// This function write b to h prefixed by its length.
+func writeField(h hash.Hash, b []byte) {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(b)))
+	h.Write(size[:])
+	h.Write(b)
+}
+
+// This function bag the labels of the frontier into the root commitment of the DAG:
+// H("root" || labels), each field prefixed by its length.
+func bagFrontier(hashStrategy func() hash.Hash, labels [][]byte) []byte {
+	h := hashStrategy()
+	writeField(h, []byte("root"))
+	for _, l := range labels {
+		writeField(h, l)
+	}
+	return h.Sum(nil)
+}
+
+// This function put a newly added node on the frontier in place of the nodes it depends
+// on, which now have a dependent, and refresh the root commitment.
+func addToFrontier(n *Node, t *CommitDAG) {
+	deps := map[*Node]bool{n.Left: true, n.Right: true}
+	for _, p := range n.Parents {
+		deps[p] = true
+	}
+	frontier := t.frontier[:0]
+	for _, f := range t.frontier {
+		if !deps[f] {
+			frontier = append(frontier, f)
+		}
+	}
+	t.frontier = append(frontier, n)
+	refreshRoot(t)
+}
+
+// This function recompute the root commitment from the labels of the frontier.
+func refreshRoot(t *CommitDAG) {
+	labels := make([][]byte, len(t.frontier))
+	for i, f := range t.frontier {
+		labels[i] = f.Hash
+	}
+	t.dagRoot = bagFrontier(t.hashStrategy, labels)
+}
 
+// This function return the root commitment of the DAG. It covers the label of every node,
+// since every node is on the frontier or a dependency of a later node, and changes on
+// every append and Update.
+func Root(t *CommitDAG) []byte {
+	return t.dagRoot
 }
 
 // This function retrun an integer number for Leafs count of the DAG.
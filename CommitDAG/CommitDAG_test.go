@@ -0,0 +1,63 @@
+package CommitDAG
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRootChangesOnAppend(t *testing.T) {
+	cs := testContents(70)
+	dag := buildDAG(t, cs[:1])
+	seen := map[string]int{string(Root(dag)): 1}
+	var labels [][]byte
+	for n, c := range cs[1:] {
+		if _, _, err := AddNodeToDAG(c, dag); err != nil {
+			t.Fatal(err)
+		}
+		root := string(Root(dag))
+		if k, ok := seen[root]; ok {
+			t.Fatalf("root after %d nodes repeats the one after %d", n+2, k)
+		}
+		seen[root] = n + 2
+		labels = append(labels, dag.Nodes[len(dag.Nodes)-1].Hash)
+	}
+	// a node keeps the label it was committed with as the DAG grows deeper
+	for k, label := range labels {
+		if !bytes.Equal(dag.Nodes[k+1].Hash, label) {
+			t.Fatalf("label of node %d changed", k+2)
+		}
+	}
+}
+
+func TestUpdateMatchesRebuild(t *testing.T) {
+	cs := testContents(45)
+	dag := buildDAG(t, cs)
+	for _, k := range []int{0, 1, 2, 4, 6, 14, 22, 30, 44} {
+		cs[k] = testContent{cs[k].x + " updated"}
+		before := Root(dag)
+		touched, err := Update(cs[k], dag.Nodes[k], dag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(touched) == 0 || touched[0] != dag.Nodes[k] {
+			t.Fatalf("node %d: touched nodes do not start with the updated one", k+1)
+		}
+		if bytes.Equal(Root(dag), before) {
+			t.Fatalf("node %d: root unchanged", k+1)
+		}
+		fresh := buildDAG(t, cs)
+		for i, n := range dag.Nodes {
+			if !bytes.Equal(n.Hash, fresh.Nodes[i].Hash) {
+				t.Fatalf("node %d: label of node %d differs from a rebuild", k+1, i+1)
+			}
+		}
+		if !bytes.Equal(Root(dag), Root(fresh)) {
+			t.Fatalf("node %d: root differs from a rebuild", k+1)
+		}
+	}
+
+	other := buildDAG(t, cs[:3])
+	if _, err := Update(cs[0], other.Nodes[0], dag); err != ErrNodeNotInDAG {
+		t.Fatalf("node of another DAG: got %v", err)
+	}
+}
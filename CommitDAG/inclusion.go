@@ -0,0 +1,196 @@
+package CommitDAG
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/bits"
+)
+
+// InclusionStep is one node on the way from an opened node to the frontier: the fields
+// its label is computed over, with the label of the previous node at Previous in Labels.
+type InclusionStep struct {
+	Height      int
+	Position    uint64
+	ContentHash []byte
+	Labels      [][]byte
+	Previous    int
+}
+
+// InclusionProof opens a node of a DAG against its root commitment. The node label is
+// recomputed from Height and Position (see nodePlace), ContentHash and Labels, the labels
+// of its Parents or of its Left and Right children; Path then leads from it to a frontier
+// node, which sits at FrontierPosition among the Frontier labels bagged into the root. An
+// honest DAG has the last node alone on its frontier, see lastPlace.
+// The traversing Number of the node follows from its place, see Number.
+type InclusionProof struct {
+	Height           int
+	Position         uint64
+	ContentHash      []byte
+	Labels           [][]byte
+	Path             []InclusionStep
+	Frontier         [][]byte
+	FrontierPosition int
+}
+
+// This function build the inclusion proof of node number (the traversing Number, from 1)
+// against Root(t). The path to the frontier is the one pathPlaces lays out.
+func ProveInclusion(t *CommitDAG, number int) (InclusionProof, error) {
+	if number < 1 || number > len(t.Nodes) {
+		return InclusionProof{}, ErrNodeNotInDAG
+	}
+	node := t.Nodes[number-1]
+	height, position := nodePlace(node, t)
+	proof := InclusionProof{
+		Height:      height,
+		Position:    position,
+		ContentHash: node.ContentHash,
+		Labels:      dependencyLabels(node),
+	}
+	at := place{height, position}
+	for _, next := range pathPlaces(at, len(t.Nodes)) {
+		n := t.Nodes[placeNumber(next.height, next.position)-1]
+		proof.Path = append(proof.Path, InclusionStep{
+			Height:      next.height,
+			Position:    next.position,
+			ContentHash: n.ContentHash,
+			Labels:      dependencyLabels(n),
+			Previous:    placeSlot(dependencyPlaces(next), at),
+		})
+		at = next
+	}
+	for _, f := range t.frontier {
+		proof.Frontier = append(proof.Frontier, f.Hash)
+	}
+	return proof, nil
+}
+
+// This function check that proof opens node number (the traversing Number, from 1) of the
+// DAG of nodes nodes committed to by root, without access to the DAG and assuming the
+// default SHA-256 hash strategy. The path must take the places pathPlaces lays out, each
+// step taking the label before it at the slot that node has among its dependencies, and
+// end at the last node, the only one on the frontier of an honest DAG. It authenticates
+// the place and ContentHash of the opened node; a caller checking some content compares
+// its hash with proof.ContentHash.
+func VerifyInclusion(root []byte, nodes int, number int, proof InclusionProof) bool {
+	if nodes < 1 || number < 1 || number > nodes || proof.Number() != number {
+		return false
+	}
+	at := place{proof.Height, proof.Position}
+	if len(proof.Labels) != len(dependencyPlaces(at)) {
+		return false
+	}
+	places := pathPlaces(at, nodes)
+	if len(proof.Path) != len(places) {
+		return false
+	}
+	label := proof.label()
+	for k, step := range proof.Path {
+		next := places[k]
+		deps := dependencyPlaces(next)
+		if step.Height != next.height || step.Position != next.position || len(step.Labels) != len(deps) || step.Previous < 0 || step.Previous != placeSlot(deps, at) || !bytes.Equal(step.Labels[step.Previous], label) {
+			return false
+		}
+		label = nodeLabel(sha256.New, step.Height, step.Position, step.ContentHash, step.Labels)
+		at = next
+	}
+	if len(proof.Frontier) != 1 || proof.FrontierPosition != 0 || !bytes.Equal(proof.Frontier[0], label) {
+		return false
+	}
+	return bytes.Equal(bagFrontier(sha256.New, proof.Frontier), root)
+}
+
+// This function return the label of the opened node.
+func (proof InclusionProof) label() []byte {
+	return nodeLabel(sha256.New, proof.Height, proof.Position, proof.ContentHash, proof.Labels)
+}
+
+// This function return the traversing Number of the opened node. Nodes are added in
+// post-order, so the node at height h and position p comes right after the subtree below
+// it, of 2^(h+1)-1 nodes, and the complete trees over the m = p*2^h leafs on its left,
+// which hold 2m-popcount(m) nodes.
+func (proof InclusionProof) Number() int {
+	return placeNumber(proof.Height, proof.Position)
+}
+
+// This function return the traversing Number of the node at height and position.
+func placeNumber(height int, position uint64) int {
+	if height < 0 || height > 60 || position >= 1<<(60-uint(height)) {
+		return 0
+	}
+	m := position << uint(height)
+	return int(2*m) - bits.OnesCount64(m) + 1<<uint(height+1) - 1
+}
+
+// place is where a node sits in the DAG, as returned by nodePlace.
+type place struct {
+	height   int
+	position uint64
+}
+
+// This function return the places of the Parents of the leaf at position, in the order
+// setParentsToNode links them: for each 1 bit of the position, the left sibling of the
+// ancestor that bit leads to.
+func parentPlaces(position uint64) []place {
+	var places []place
+	for h := 0; position>>uint(h) > 0; h++ {
+		if (position>>uint(h))&1 == 1 {
+			places = append(places, place{h, position>>uint(h) - 1})
+		}
+	}
+	return places
+}
+
+// This function return the places of the nodes the node at pl depends on, in the order
+// their labels go into its label: Left and Right for an intermediate node, Parents for a
+// leaf.
+func dependencyPlaces(pl place) []place {
+	if pl.height > 0 {
+		return []place{{pl.height - 1, 2 * pl.position}, {pl.height - 1, 2*pl.position + 1}}
+	}
+	return parentPlaces(pl.position)
+}
+
+// This function return the place of the last of nodes nodes. Every node added takes the
+// nodes it depends on off the frontier, so the last one is all that is left on it; it
+// roots the last of the perfect trees the DAG is made of (see leafCount).
+func lastPlace(nodes int) place {
+	var last place
+	leafs := 0
+	for h := depthOf(nodes); h >= 0; h-- {
+		for size := 1<<(h+1) - 1; nodes >= size; nodes -= size {
+			last = place{h, uint64(leafs >> uint(h))}
+			leafs += 1 << h
+		}
+	}
+	return last
+}
+
+// This function return the places on the path from the node at from to the last of nodes
+// nodes. The path climbs the tree ancestors of the node, each taking the one before as
+// its Left or Right child by the low bit of its position, to the root of the perfect tree
+// holding it (see leafCount). From there it goes on to the first leaf after that tree,
+// which has the root among its Parents, and climbs again, up to the root of the last
+// perfect tree, the last node. So the openings of a leaf and of its Parents meet on the
+// tree paths above them, and every label on the way is checked against its children.
+func pathPlaces(from place, nodes int) []place {
+	var path []place
+	for at := from; placeNumber(at.height, at.position) < nodes; {
+		next := place{at.height + 1, at.position >> 1}
+		if n := placeNumber(next.height, next.position); n == 0 || n > nodes {
+			next = place{0, (at.position + 1) << uint(at.height)}
+		}
+		path = append(path, next)
+		at = next
+	}
+	return path
+}
+
+// This function return the slot of pl among deps, or -1.
+func placeSlot(deps []place, pl place) int {
+	for i, d := range deps {
+		if d == pl {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,119 @@
+package CommitDAG
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestInclusion(t *testing.T) {
+	cs := testContents(40)
+	for n := 1; n <= len(cs); n++ {
+		dag := buildDAG(t, cs[:n])
+		root := Root(dag)
+		for k := 1; k <= n; k++ {
+			proof, err := ProveInclusion(dag, k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, _ := cs[k-1].CalculateHash()
+			if !VerifyInclusion(root, n, k, proof) || !bytes.Equal(proof.ContentHash, content) {
+				t.Fatalf("%d nodes: node %d not opened", n, k)
+			}
+			if VerifyInclusion(root, n, k+1, proof) || VerifyInclusion(root, n+1, k, proof) || VerifyInclusion(root, k-1, k, proof) {
+				t.Fatalf("%d nodes: node %d opened at another number or size", n, k)
+			}
+		}
+	}
+	if _, err := ProveInclusion(buildDAG(t, cs[:3]), 4); err != ErrNodeNotInDAG {
+		t.Fatalf("node past the end: got %v", err)
+	}
+}
+
+// reseal recomputes the labels along the path of proof and its frontier after proof was
+// changed, and returns the root they bag into, so that the change is checked for its
+// shape rather than caught by a wrong root.
+func reseal(proof *InclusionProof) []byte {
+	label := proof.label()
+	path := make([]InclusionStep, len(proof.Path))
+	for k, step := range proof.Path {
+		step.Labels = append([][]byte(nil), step.Labels...)
+		if step.Previous >= 0 && step.Previous < len(step.Labels) {
+			step.Labels[step.Previous] = label
+		}
+		label = nodeLabel(sha256.New, step.Height, step.Position, step.ContentHash, step.Labels)
+		path[k] = step
+	}
+	proof.Path = path
+	proof.Frontier = append([][]byte(nil), proof.Frontier...)
+	if proof.FrontierPosition >= 0 && proof.FrontierPosition < len(proof.Frontier) {
+		proof.Frontier[proof.FrontierPosition] = label
+	}
+	return bagFrontier(sha256.New, proof.Frontier)
+}
+
+func TestForgedInclusionRejected(t *testing.T) {
+	const nodes, number = 20, 5
+	dag := buildDAG(t, testContents(nodes))
+	honest, err := ProveInclusion(dag, number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(honest.Frontier) != 1 {
+		t.Fatalf("honest DAG has %d frontier labels", len(honest.Frontier))
+	}
+	resealed := honest
+	if !VerifyInclusion(reseal(&resealed), nodes, number, resealed) {
+		t.Fatal("resealed honest proof rejected")
+	}
+
+	// a second opening of node 5, to other content, from a label added to the frontier
+	forged := InclusionProof{Height: honest.Height, Position: honest.Position, ContentHash: []byte("other"), Labels: honest.Labels}
+	forged.Frontier = append(append([][]byte(nil), honest.Frontier...), forged.label())
+	forged.FrontierPosition = 1
+	root := bagFrontier(sha256.New, forged.Frontier)
+	equivocated := honest
+	equivocated.Frontier = forged.Frontier
+	if VerifyInclusion(root, nodes, number, forged) || VerifyInclusion(root, nodes, number, equivocated) {
+		t.Fatal("node opened from a frontier of two labels")
+	}
+
+	for name, change := range map[string]func(p *InclusionProof){
+		"extra label on the node": func(p *InclusionProof) { p.Labels = append(p.Labels, []byte("extra")) },
+		"missing label":           func(p *InclusionProof) { p.Labels = p.Labels[:1] },
+		"extra label on a step": func(p *InclusionProof) {
+			p.Path = append([]InclusionStep(nil), p.Path...)
+			p.Path[0].Labels = append(p.Path[0].Labels, []byte("extra"))
+		},
+		"step moved": func(p *InclusionProof) {
+			p.Path = append([]InclusionStep(nil), p.Path...)
+			p.Path[1].Position++
+		},
+		"other slot": func(p *InclusionProof) {
+			p.Path = append([]InclusionStep(nil), p.Path...)
+			p.Path[0].Previous ^= 1
+		},
+		"path cut short": func(p *InclusionProof) { p.Path = p.Path[:len(p.Path)-1] },
+	} {
+		p := honest
+		change(&p)
+		if VerifyInclusion(reseal(&p), nodes, number, p) {
+			t.Fatalf("%s: accepted", name)
+		}
+	}
+
+	// node 3 at (1,0) is a Parent of leaf 2, node 4, but opens through its tree parent
+	leaf, err := ProveInclusion(dag, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := dag.Nodes[3]
+	aside, err := ProveInclusion(dag, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aside.Path = append([]InclusionStep{{Height: leaf.Height, Position: leaf.Position, ContentHash: node.ContentHash, Labels: dependencyLabels(node), Previous: 0}}, leaf.Path...)
+	if VerifyInclusion(Root(dag), nodes, 3, aside) {
+		t.Fatal("node opened through a leaf depending on it")
+	}
+}
@@ -0,0 +1,157 @@
+package CommitDAG
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+)
+
+// ErrBadChallenge is returned when a challenge samples nothing or covers an empty DAG.
+var ErrBadChallenge = errors.New("CommitDAG: bad challenge")
+
+// ErrWrongRoot is returned when a challenge was drawn for another DAG.
+var ErrWrongRoot = errors.New("CommitDAG: challenge is for another root")
+
+// Challenge asks for the openings of Leaves, ordinals from 0 among the leaves of a DAG of
+// Nodes nodes committed to by Root. Each sampled leaf catches a prover that skipped a
+// fraction f of the sequential work with probability about f, so the number of samples is
+// the soundness parameter.
+type Challenge struct {
+	Root   []byte
+	Nodes  int
+	Leaves []int
+}
+
+// LeafOpening answers one sampled leaf: its inclusion proof and those of its Parents, in
+// the order their labels appear in Leaf.Labels.
+type LeafOpening struct {
+	Leaf    InclusionProof
+	Parents []InclusionProof
+}
+
+// Response answers a challenge with one opening per sampled leaf.
+type Response struct {
+	Openings []LeafOpening
+}
+
+// This function return the depth of a DAG of nodes nodes, the length of its leaf indexes.
+func depthOf(nodes int) int {
+	return int(math.Log2(float64(nodes + 1)))
+}
+
+// This function return the number of leafs of a DAG of nodes nodes. Nodes are added in
+// post-order, so the DAG is a sequence of perfect trees of decreasing height.
+func leafCount(nodes int) int {
+	leafs := 0
+	for h := depthOf(nodes); h >= 0; h-- {
+		for size := 1<<(h+1) - 1; nodes >= size; nodes -= size {
+			leafs += 1 << h
+		}
+	}
+	return leafs
+}
+
+// This function sample samples leaf ordinals at random for the DAG of nodes nodes
+// committed to by root.
+func NewChallenge(root []byte, nodes int, samples int) (Challenge, error) {
+	if nodes < 1 || samples < 1 {
+		return Challenge{}, ErrBadChallenge
+	}
+	ch := Challenge{Root: root, Nodes: nodes}
+	leafs := big.NewInt(int64(leafCount(nodes)))
+	for i := 0; i < samples; i++ {
+		n, err := rand.Int(rand.Reader, leafs)
+		if err != nil {
+			return Challenge{}, err
+		}
+		ch.Leaves = append(ch.Leaves, int(n.Int64()))
+	}
+	return ch, nil
+}
+
+// This function derive the challenge from root and nodes alone (Fiat–Shamir), so that the
+// prover can answer without a verifier and anyone can recompute what was asked.
+func FiatShamirChallenge(root []byte, nodes int, samples int) (Challenge, error) {
+	if nodes < 1 || samples < 1 {
+		return Challenge{}, ErrBadChallenge
+	}
+	ch := Challenge{Root: root, Nodes: nodes}
+	leafs := uint64(leafCount(nodes))
+	for i := 0; i < samples; i++ {
+		h := sha256.New()
+		writeField(h, []byte("posw-challenge"))
+		writeField(h, root)
+		var counters [16]byte
+		binary.BigEndian.PutUint64(counters[:8], uint64(nodes))
+		binary.BigEndian.PutUint64(counters[8:], uint64(i))
+		h.Write(counters[:])
+		ch.Leaves = append(ch.Leaves, int(binary.BigEndian.Uint64(h.Sum(nil))%leafs))
+	}
+	return ch, nil
+}
+
+// This function answer ch for the DAG t, which must be the one ch was drawn for.
+func Respond(t *CommitDAG, ch Challenge) (Response, error) {
+	if !bytes.Equal(ch.Root, Root(t)) || ch.Nodes != len(t.Nodes) {
+		return Response{}, ErrWrongRoot
+	}
+	depth := depthOf(ch.Nodes)
+	var r Response
+	for _, ordinal := range ch.Leaves {
+		node := IsNodeInDAG(integerToBinaryString(ordinal, depth), t)
+		if node == nil || !node.leaf {
+			return Response{}, ErrBadChallenge
+		}
+		leaf, err := ProveInclusion(t, node.Number)
+		if err != nil {
+			return Response{}, err
+		}
+		opening := LeafOpening{Leaf: leaf}
+		for _, p := range node.Parents {
+			if p == node {
+				continue
+			}
+			parent, err := ProveInclusion(t, p.Number)
+			if err != nil {
+				return Response{}, err
+			}
+			opening.Parents = append(opening.Parents, parent)
+		}
+		r.Openings = append(r.Openings, opening)
+	}
+	return r, nil
+}
+
+// This function check every opening of r against ch: each leaf must sit at the sampled
+// position, be included under ch.Root, and have been labelled over the labels of its
+// Parents, which must be included under ch.Root too. Inclusion is checked through the
+// tree ancestors of each node and the roots of the perfect trees a DAG of ch.Nodes nodes
+// is made of (see pathPlaces), so a parent label cannot be vouched for by the frontier
+// alone and must have been computed over the labels of its own children.
+func VerifyResponse(ch Challenge, r Response) bool {
+	if ch.Nodes < 1 || len(ch.Leaves) == 0 || len(r.Openings) != len(ch.Leaves) {
+		return false
+	}
+	leafs := leafCount(ch.Nodes)
+	for k, ordinal := range ch.Leaves {
+		opening := r.Openings[k]
+		leaf := opening.Leaf
+		if ordinal < 0 || ordinal >= leafs || !VerifyInclusion(ch.Root, ch.Nodes, placeNumber(0, uint64(ordinal)), leaf) {
+			return false
+		}
+		parents := parentPlaces(leaf.Position)
+		if len(leaf.Labels) != len(parents) || len(opening.Parents) != len(parents) {
+			return false
+		}
+		for i, parent := range opening.Parents {
+			if !bytes.Equal(parent.label(), leaf.Labels[i]) || !VerifyInclusion(ch.Root, ch.Nodes, placeNumber(parents[i].height, parents[i].position), parent) {
+				return false
+			}
+		}
+	}
+	return true
+}
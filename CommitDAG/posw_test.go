@@ -0,0 +1,147 @@
+package CommitDAG
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+type testContent struct {
+	x string
+}
+
+func (c testContent) CalculateHash() ([]byte, error) {
+	h := sha256.Sum256([]byte(c.x))
+	return h[:], nil
+}
+
+func (c testContent) Equals(other Content) (bool, error) {
+	return c.x == other.(testContent).x, nil
+}
+
+func (c testContent) GetData() string {
+	return c.x
+}
+
+// testContents returns n distinct contents.
+func testContents(n int) []testContent {
+	cs := make([]testContent, n)
+	for i := range cs {
+		cs[i] = testContent{fmt.Sprint("content ", i)}
+	}
+	return cs
+}
+
+// buildDAG adds cs to a new DAG in order.
+func buildDAG(t *testing.T, cs []testContent) *CommitDAG {
+	t.Helper()
+	dag, err := NewDAGGenesis(cs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cs[1:] {
+		if _, _, err := AddNodeToDAG(c, dag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dag
+}
+
+func TestResponse(t *testing.T) {
+	cs := testContents(70)
+	for n := 1; n <= len(cs); n++ {
+		dag := buildDAG(t, cs[:n])
+		fs, err := FiatShamirChallenge(Root(dag), n, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		random, err := NewChallenge(Root(dag), n, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ch := range []Challenge{fs, random} {
+			r, err := Respond(dag, ch)
+			if err != nil {
+				t.Fatalf("%d nodes: %v", n, err)
+			}
+			if !VerifyResponse(ch, r) {
+				t.Fatalf("%d nodes: honest response rejected", n)
+			}
+			other := ch
+			other.Nodes++
+			if VerifyResponse(other, r) {
+				t.Fatalf("%d nodes: response accepted for %d nodes", n, other.Nodes)
+			}
+			tampered := false
+			for _, opening := range r.Openings {
+				if len(opening.Parents) > 0 {
+					opening.Parents[0].ContentHash = []byte("other")
+					tampered = true
+					break
+				}
+			}
+			if tampered && VerifyResponse(ch, r) {
+				t.Fatalf("%d nodes: tampered parent accepted", n)
+			}
+		}
+	}
+
+	other, err := FiatShamirChallenge(Root(buildDAG(t, cs[:6])), 6, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Respond(buildDAG(t, cs[:5]), other); err != ErrWrongRoot {
+		t.Fatalf("challenge for another DAG: got %v", err)
+	}
+}
+
+// forgeResponse answers the Fiat-Shamir challenge for a DAG of 31 nodes, a perfect tree
+// over 16 leafs, with a few sequential hashes instead of 31: every intermediate node is
+// labelled over junk children at once, each leaf over those labels, and all the labels
+// are put on the frontier, where every opening points at its own one with an empty path.
+func forgeResponse() (Challenge, Response) {
+	const nodes, leafs = 31, 16
+	junk := [][]byte{[]byte("left"), []byte("right")}
+	openings := make(map[place]InclusionProof)
+	var frontier [][]byte
+	open := func(pl place, labels [][]byte) {
+		proof := InclusionProof{Height: pl.height, Position: pl.position, ContentHash: []byte("forged"), Labels: labels, FrontierPosition: len(frontier)}
+		openings[pl] = proof
+		frontier = append(frontier, proof.label())
+	}
+	for h := 1; 1<<h <= leafs; h++ {
+		for p := uint64(0); p < leafs>>h; p++ {
+			open(place{h, p}, junk)
+		}
+	}
+	for p := uint64(0); p < leafs; p++ {
+		var labels [][]byte
+		for _, parent := range parentPlaces(p) {
+			labels = append(labels, openings[parent].label())
+		}
+		open(place{0, p}, labels)
+	}
+
+	ch, _ := FiatShamirChallenge(bagFrontier(sha256.New, frontier), nodes, 16)
+	var r Response
+	for _, ordinal := range ch.Leaves {
+		withFrontier := func(pl place) InclusionProof {
+			proof := openings[pl]
+			proof.Frontier = frontier
+			return proof
+		}
+		opening := LeafOpening{Leaf: withFrontier(place{0, uint64(ordinal)})}
+		for _, parent := range parentPlaces(uint64(ordinal)) {
+			opening.Parents = append(opening.Parents, withFrontier(parent))
+		}
+		r.Openings = append(r.Openings, opening)
+	}
+	return ch, r
+}
+
+func TestForgedResponseRejected(t *testing.T) {
+	ch, r := forgeResponse()
+	if VerifyResponse(ch, r) {
+		t.Fatal("response from a frontier of unrelated labels accepted")
+	}
+}
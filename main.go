@@ -3,7 +3,9 @@ package main
 import (
 	"CommitDAG/CommitDAG"
 	"CommitDAG/por"
+	"context"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -97,9 +99,13 @@ func sha256RunTest(directoryPath string) {
 	}
 }
 
-func porTestRun(directoryPath string) {
+func porTestRun(directoryPath string, schemeName string) {
 	/*  POR example run  */
 
+	scheme, err := por.Lookup(schemeName)
+	if err != nil {
+		log.Fatal(err)
+	}
 	files, err := ioutil.ReadDir(directoryPath)
 	if err != nil {
 		log.Fatal(err)
@@ -120,25 +126,45 @@ func porTestRun(directoryPath string) {
 		if err != nil {
 			return
 		}
-		fmt.Printf("Generating RSA keys...\n")
-		spk, ssk := por.Keygen()
+		fmt.Printf("Generating %s keys...\n", scheme.Name())
+		keys, err := scheme.KeyGen()
+		if err != nil {
+			log.Fatal(err)
+		}
 		fmt.Printf("Generated!\n")
 		fmt.Printf("Signing file...\n")
-		tau, authenticators := por.St(ssk, file)
+		var authenticators por.Authenticators
+		tau, err := scheme.Tag(context.Background(), keys.Secret, file, scheme.DefaultParams(), &authenticators, por.StOptions{})
+		if err != nil {
+			log.Fatal(err)
+		}
 		fmt.Printf("Signed!\n")
 		fmt.Printf("Generating challenge...\n")
-		q := por.Verify_one(tau, spk)
+		q, err := scheme.Challenge(keys.Verifier, tau, por.DefaultChallengeSpec)
+		if err != nil {
+			log.Fatal(err)
+		}
 		fmt.Printf("Generated!\n")
 
 		fmt.Printf("Issuing proof for file ..\n")
 
-		mu, sigma := por.Prove(q, authenticators, spk, file)
+		src, err := por.FileSource(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		proof, err := scheme.Prove(keys.Prover, tau, q, authenticators, src)
+		if err != nil {
+			log.Fatal(err)
+		}
 		fmt.Printf("Issued!\n")
 
 		fmt.Printf("Verifying proof of file: ")
 		fmt.Println(path)
 		fmt.Printf("File size: %v KB\n", fs/1024)
-		yes := por.Verify_two(tau, q, mu, sigma, spk)
+		yes, err := scheme.Verify(keys.Verifier, tau, q, proof)
+		if err != nil {
+			log.Fatal(err)
+		}
 		fmt.Printf("Result: %t!\n", yes)
 		if yes {
 			file.Close()
@@ -151,6 +177,117 @@ func porTestRun(directoryPath string) {
 	}
 }
 
+func porChainTestRun(path string, rounds int64) {
+	/*  Non-interactive POR example run: every proof is committed to a CommitDAG
+	    and seeds the challenge of the next round  */
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	spk, ssk, err := por.Keygen(por.DefaultKeyBits)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var authenticators por.Authenticators
+	tau, err := por.St(context.Background(), ssk, file, por.DefaultParams, &authenticators, por.StOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dag, err := CommitDAG.NewDAGGenesis(TestContent{x: path})
+	if err != nil {
+		log.Fatal(err)
+	}
+	genesis := dag.Nodes[0].Hash
+	commit := func(round int64, proof por.Proof) ([]byte, error) {
+		b, err := proof.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err := CommitDAG.AddNodeToDAG(TestContent{x: hex.EncodeToString(b)}, dag); err != nil {
+			return nil, err
+		}
+		return dag.Nodes[len(dag.Nodes)-1].Hash, nil
+	}
+	src, err := por.FileSource(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	links, err := por.ProveChain(tau, spk, authenticators, src, por.DefaultChallengeSpec, genesis, rounds, commit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	yes, err := por.VerifyChain(tau, spk, por.DefaultChallengeSpec, genesis, links)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Chain of %d proofs: %t!\n", len(links), yes)
+}
+
+func manifestTestRun(directoryPath string, audited int) {
+	/*  Deposit example run: every file of a directory is tagged under one key,
+	    then a random subset is audited from the signed manifest  */
+
+	spk, ssk, err := por.Keygen(por.DefaultKeyBits)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stores, err := ioutil.TempDir("", "por-authenticators")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(stores)
+	storePath := func(path string) string {
+		return stores + "/" + hex.EncodeToString([]byte(path))
+	}
+
+	fmt.Printf("Tagging %s...\n", directoryPath)
+	manifest, err := por.TagDirectory(context.Background(), ssk, directoryPath, por.DefaultParams, por.DirectoryOptions{
+		Sink: func(path string) (por.AuthenticatorSink, error) {
+			return por.CreateAuthenticatorStore(storePath(path), spk)
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Tagged %d files!\n", len(manifest.Entries))
+
+	audit, err := por.NewAudit(manifest, spk, audited, por.DefaultChallengeSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var opened []io.Closer
+	defer func() {
+		for _, c := range opened {
+			c.Close()
+		}
+	}()
+	proof, err := por.ProveAudit(manifest, audit, spk, func(path string) (por.AuthenticatorSource, por.BlockSource, error) {
+		store, err := por.OpenAuthenticatorStore(storePath(path), spk)
+		if err != nil {
+			return nil, nil, err
+		}
+		opened = append(opened, store)
+		file, err := os.Open(directoryPath + "/" + path)
+		if err != nil {
+			return nil, nil, err
+		}
+		opened = append(opened, file)
+		src, err := por.FileSource(file)
+		return store, src, err
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	yes, err := por.VerifyAudit(manifest, audit, proof, spk)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Audit of %v: %t!\n", audit.Paths, yes)
+}
+
 func main() {
 	// sha256RunTest()
 
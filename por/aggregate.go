@@ -0,0 +1,67 @@
+package por
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+)
+
+// Aggregated proofs
+//
+// Files tagged under the same key can be audited together: the storer answers
+// the challenges of every file with one mu vector per file and a single
+//
+//	sigma = prod_f prod_i sigma_fi^v_fi  mod N
+//
+// and the verifier checks sigma^e = ±prod_f x_f, where x_f is the value a
+// separate proof for file f would have to meet; sigma is in canonical form, as
+// in a Proof. Names differ between files, so the authenticators of one file
+// cannot stand in for those of another.
+
+// AggregateProof answers the challenges of several files: Mu[f] is the mu
+// vector of file f.
+type AggregateProof struct {
+	Mu    [][]*big.Int
+	Sigma *big.Int
+}
+
+// AggregateProve answers chs[f] for every file f, given its tag, its
+// authenticators and its stored copy.
+func AggregateProve(taus []Tau, chs []Challenge, authenticators []AuthenticatorSource, spk *rsa.PublicKey, files []BlockSource) (AggregateProof, error) {
+	if len(chs) != len(taus) || len(authenticators) != len(taus) || len(files) != len(taus) {
+		return AggregateProof{}, fmt.Errorf("%w: %d tags, %d challenges, %d authenticator sets and %d files", ErrBadParams, len(taus), len(chs), len(authenticators), len(files))
+	}
+	proof := AggregateProof{Mu: make([][]*big.Int, len(taus)), Sigma: big.NewInt(1)}
+	for f := range taus {
+		p, err := Prove(taus[f], chs[f], authenticators[f], spk, files[f])
+		if err != nil {
+			return AggregateProof{}, fmt.Errorf("file %d: %w", f, err)
+		}
+		proof.Mu[f] = p.Mu
+		proof.Sigma.Mod(proof.Sigma.Mul(proof.Sigma, p.Sigma), spk.N)
+	}
+	proof.Sigma = canonicalSigma(proof.Sigma, spk.N)
+	return proof, nil
+}
+
+// AggregateVerify reports whether proof answers chs[f] for every file f. Like
+// Verify_two it does not check the tag signatures, which Verify_one does when
+// the challenges are drawn. An aggregate proof carries no challenge digests;
+// bound challenges are checked for their file and deadline only.
+func AggregateVerify(taus []Tau, chs []Challenge, proof AggregateProof, spk *rsa.PublicKey) (bool, error) {
+	if len(chs) != len(taus) || len(proof.Mu) != len(taus) || !isCanonicalSigma(proof.Sigma, spk.N) {
+		return false, ErrMalformedProof
+	}
+	expected := big.NewInt(1)
+	for f := range taus {
+		if err := checkBinding(chs[f], taus[f].Tau_zero); err != nil {
+			return false, fmt.Errorf("file %d: %w", f, err)
+		}
+		x, err := expectedSigma(taus[f], chs[f], proof.Mu[f], spk)
+		if err != nil {
+			return false, fmt.Errorf("file %d: %w", f, err)
+		}
+		expected.Mod(expected.Mul(expected, x), spk.N)
+	}
+	return equalUpToSign(new(big.Int).Exp(proof.Sigma, new(big.Int).SetInt64(int64(spk.E)), spk.N), expected, spk.N), nil
+}
@@ -0,0 +1,156 @@
+package por
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// Batch verification
+//
+// Proofs under one public key are checked together with small random exponents
+// r_k: every proof holds exactly when
+//
+//	(prod_k sigma_k^r_k)^e = ±prod_k h_k^r_k * prod_j u_j^(sum_k r_k mu_kj)  mod N
+//
+// where h_k = prod_i H(name_k || i)^v_ki, up to a chance of about
+// 2^-batchExponentBits that a wrong proof slips through. The last product is
+// taken once per tag over all the proofs sharing its generators u_j, so the
+// u_j exponentiations, which cost Verify_two as much as the h_k, are paid once
+// per tag rather than once per proof; proofs over distinct tags only save the
+// exponentiation by e. When the batch fails it is split in halves until the
+// failing proofs are isolated.
+//
+// The sign is left out of the check because (-1)^r_k depends on the parity of
+// r_k only, so no choice of exponents catches sigma_k replaced by N - sigma_k.
+// Proofs carry sigma in canonical form instead, and Verify_two checks them up
+// to sign as well (see canonicalSigma), so both accept a single sigma per
+// challenge.
+
+const batchExponentBits = 64
+
+// BatchItem is one proof to check in BatchVerify.
+type BatchItem struct {
+	Tau       Tau
+	Challenge Challenge
+	Proof     Proof
+}
+
+// batchEntry is a proof that passed the cheap checks, with the values that go
+// into the batch equation.
+type batchEntry struct {
+	r      *big.Int
+	sigma  *big.Int // sigma_k^r_k
+	hashes *big.Int // h_k^r_k
+	mu     []*big.Int
+	tag    int // index of the tag generators in BatchVerify
+}
+
+// BatchVerify checks every item under spk and returns the indices of those
+// that fail, in increasing order; it returns none when all pass. Items that
+// Verify_two would reject with an error count as failing.
+func BatchVerify(items []BatchItem, spk *rsa.PublicKey) ([]int, error) {
+	var failed, pending []int
+	entries := make([]batchEntry, len(items))
+	var generators [][]big.Int
+	tags := make(map[[sha256.Size]byte]int)
+	bound := new(big.Int).Lsh(big.NewInt(1), batchExponentBits)
+	for k, item := range items {
+		if !isCanonicalSigma(item.Proof.Sigma, spk.N) || checkMu(item.Tau, item.Proof.Mu) != nil || checkAnswers(item.Challenge, item.Tau.Tau_zero, item.Proof.Challenge) != nil {
+			failed = append(failed, k)
+			continue
+		}
+		h, err := hashProduct(item.Tau, item.Challenge, spk)
+		if err != nil {
+			failed = append(failed, k)
+			continue
+		}
+		r, err := rand.Int(rand.Reader, bound)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRandomness, err)
+		}
+		key := generatorsKey(item.Tau.U)
+		tag, ok := tags[key]
+		if !ok {
+			tag = len(generators)
+			tags[key] = tag
+			generators = append(generators, item.Tau.U)
+		}
+		entries[k] = batchEntry{
+			r:      r,
+			sigma:  new(big.Int).Exp(item.Proof.Sigma, r, spk.N),
+			hashes: h.Exp(h, r, spk.N),
+			mu:     item.Proof.Mu,
+			tag:    tag,
+		}
+		pending = append(pending, k)
+	}
+
+	e := new(big.Int).SetInt64(int64(spk.E))
+	holds := func(ks []int) bool {
+		left, right := big.NewInt(1), big.NewInt(1)
+		exponents := make(map[int][]*big.Int)
+		for _, k := range ks {
+			entry := entries[k]
+			left.Mod(left.Mul(left, entry.sigma), spk.N)
+			right.Mod(right.Mul(right, entry.hashes), spk.N)
+			sums, ok := exponents[entry.tag]
+			if !ok {
+				sums = make([]*big.Int, len(entry.mu))
+				for j := range sums {
+					sums[j] = new(big.Int)
+				}
+				exponents[entry.tag] = sums
+			}
+			for j, mu := range entry.mu {
+				sums[j].Add(sums[j], new(big.Int).Mul(entry.r, mu))
+			}
+		}
+		for tag, sums := range exponents {
+			product, err := uProduct(generators[tag], sums, spk.N)
+			if err != nil {
+				return false
+			}
+			right.Mod(right.Mul(right, product), spk.N)
+		}
+		return equalUpToSign(left.Exp(left, e, spk.N), right, spk.N)
+	}
+	var bisect func(ks []int)
+	bisect = func(ks []int) {
+		if len(ks) == 0 || holds(ks) {
+			return
+		}
+		if len(ks) == 1 {
+			failed = append(failed, ks[0])
+			return
+		}
+		bisect(ks[:len(ks)/2])
+		bisect(ks[len(ks)/2:])
+	}
+	bisect(pending)
+	if len(failed) == 0 {
+		return nil, nil
+	}
+	sort.Ints(failed)
+	return failed, nil
+}
+
+// generatorsKey identifies the generators u_j of a tag, so that proofs over
+// the same tag share one product in BatchVerify.
+func generatorsKey(u []big.Int) [sha256.Size]byte {
+	h := sha256.New()
+	var size [8]byte
+	for j := range u {
+		b := u[j].Bytes()
+		binary.BigEndian.PutUint64(size[:], uint64(len(b)))
+		h.Write(size[:])
+		h.Write(b)
+	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
@@ -0,0 +1,84 @@
+package por
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+// batchItems returns perTag honest items over each of tags fresh tags.
+func batchItems(t *testing.T, tags, perTag int) []BatchItem {
+	t.Helper()
+	spk, _ := testKeys(t)
+	var items []BatchItem
+	for f := 0; f < tags; f++ {
+		tau, authenticators, data := testTag(t)
+		for k := 0; k < perTag; k++ {
+			ch, err := Verify_one(tau, spk, ChallengeSpec{L: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			proof, err := Prove(tau, ch, authenticators, spk, BytesSource(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			items = append(items, BatchItem{Tau: tau, Challenge: ch, Proof: proof})
+		}
+	}
+	return items
+}
+
+func TestBatchVerify(t *testing.T) {
+	spk, _ := testKeys(t)
+	items := batchItems(t, 3, 4)
+	if failed, err := BatchVerify(items, spk); failed != nil || err != nil {
+		t.Fatalf("honest batch: failed %v, %v", failed, err)
+	}
+
+	// the bad items are spread over the tags and the halves of the bisection
+	badMu := []int{1, 6, 7}
+	flipped := []int{3, 10}
+	for _, k := range badMu {
+		proof := &items[k].Proof
+		proof.Mu = append([]*big.Int(nil), proof.Mu...)
+		proof.Mu[0] = new(big.Int).Add(proof.Mu[0], big.NewInt(1))
+		// well formed, so only the bisection can single it out
+		if err := checkMu(items[k].Tau, proof.Mu); err != nil {
+			t.Fatalf("item %d: %v", k, err)
+		}
+	}
+	for _, k := range flipped {
+		proof := &items[k].Proof
+		proof.Sigma = new(big.Int).Sub(spk.N, proof.Sigma)
+		if ok, _ := Verify_two(items[k].Tau, items[k].Challenge, *proof, spk); ok {
+			t.Fatalf("item %d: Verify_two accepted N - sigma", k)
+		}
+	}
+	failed, err := BatchVerify(items, spk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 3, 6, 7, 10}; !reflect.DeepEqual(failed, want) {
+		t.Fatalf("failed %v, want %v", failed, want)
+	}
+	for _, k := range failed {
+		if ok, _ := Verify_two(items[k].Tau, items[k].Challenge, items[k].Proof, spk); ok {
+			t.Fatalf("item %d fails the batch but passes Verify_two", k)
+		}
+	}
+}
+
+func TestBatchVerifySwappedProofs(t *testing.T) {
+	spk, _ := testKeys(t)
+	items := batchItems(t, 2, 2)
+	// proofs answering another challenge of the same tag, or another tag
+	items[0].Proof, items[1].Proof = items[1].Proof, items[0].Proof
+	items[3].Tau = items[0].Tau
+	failed, err := BatchVerify(items, spk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1, 3}; !reflect.DeepEqual(failed, want) {
+		t.Fatalf("failed %v, want %v", failed, want)
+	}
+}
@@ -0,0 +1,343 @@
+package por
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"time"
+)
+
+type QElement struct {
+	I int64
+	V int64
+}
+
+// Challenge is the set of (block, coefficient) pairs a verifier asks about.
+// Confidence is the probability that the challenge hits at least one
+// corrupted block, given the corruption fraction it was sized for.
+//
+// A seeded challenge travels as Seed, L and N only: prover and verifier both
+// expand the seed into the same L pairs over blocks 1..N, so its size does
+// not depend on L.
+//
+// A bound challenge also carries a verifier Nonce, the FileID of the tag it
+// was drawn for and, unless zero, a Deadline. The pairs are expanded from the
+// seed together with all three, so a proof cached from an earlier audit does
+// not answer it, and a proof names the challenge it answers by its Digest.
+type Challenge struct {
+	Seed       []byte
+	L          int64
+	N          int64
+	Q          []QElement
+	Confidence float64
+	Nonce      []byte
+	FileID     []byte
+	Deadline   time.Time
+}
+
+// MinSeedSize is the shortest seed accepted for a seeded challenge.
+const MinSeedSize = 16
+
+// ChallengeSpec sizes a challenge. When L is positive exactly L distinct blocks
+// are challenged. Otherwise enough blocks are challenged to catch a prover that
+// lost a Corruption fraction of the blocks with probability at least Detection.
+// Challenges over an erasure coded file ignore Corruption: the fraction follows
+// from the code, see codeSpec.
+//
+// Lifetime, when positive, sets the deadline of challenges drawn by a verifier
+// to that long after they are drawn.
+type ChallengeSpec struct {
+	L          int64
+	Detection  float64
+	Corruption float64
+	Lifetime   time.Duration
+}
+
+// DefaultChallengeSpec catches the loss of 1% of the blocks 99% of the time,
+// which takes about 460 blocks on a large file.
+var DefaultChallengeSpec = ChallengeSpec{Detection: 0.99, Corruption: 0.01}
+
+// size returns the number of blocks to challenge out of n and the resulting
+// detection probability. Indices are drawn without replacement, so the miss
+// probability with c = ceil(Corruption*n) bad blocks is
+// prod_{k<l} (n-c-k)/(n-k).
+func (spec ChallengeSpec) size(n int64) (int64, float64, error) {
+	if n < 1 {
+		return 0, 0, fmt.Errorf("%w: tag covers no blocks", ErrChallengeOutOfRange)
+	}
+	if spec.Corruption < 0 || spec.Corruption > 1 || spec.Detection < 0 || spec.Detection > 1 {
+		return 0, 0, fmt.Errorf("%w: probabilities must lie in [0, 1]", ErrBadParams)
+	}
+	if spec.L <= 0 && (spec.Detection == 0 || spec.Corruption == 0) {
+		return 0, 0, fmt.Errorf("%w: challenge needs a block count or a detection target", ErrBadParams)
+	}
+	c := int64(spec.Corruption * float64(n))
+	if float64(c) < spec.Corruption*float64(n) {
+		c++
+	}
+
+	miss := 1.0
+	l := int64(0)
+	for l < n {
+		if spec.L > 0 && l == spec.L {
+			break
+		}
+		if spec.L <= 0 && 1-miss >= spec.Detection {
+			break
+		}
+		miss *= float64(n-c-l) / float64(n-l)
+		if miss < 0 {
+			miss = 0
+		}
+		l++
+	}
+	if spec.Corruption == 0 {
+		return l, 0, nil
+	}
+	return l, 1 - miss, nil
+}
+
+// uniform returns an integer drawn uniformly from [0, bound) using the bytes
+// of r.
+func uniform(r io.Reader, bound uint64) (uint64, error) {
+	var b [8]byte
+	// reject the top partial range so every residue is equally likely
+	limit := ^uint64(0) - (^uint64(0)%bound+1)%bound
+	for {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrRandomness, err)
+		}
+		if v := binary.BigEndian.Uint64(b[:]); v <= limit {
+			return v % bound, nil
+		}
+	}
+}
+
+// sampleIndices draws l distinct block numbers from 1..n with Floyd's
+// algorithm, so the cost is O(l) whatever the size of the file.
+func sampleIndices(r io.Reader, l, n int64) ([]int64, error) {
+	chosen := make(map[int64]bool, l)
+	indices := make([]int64, 0, l)
+	for j := n - l + 1; j <= n; j++ {
+		t, err := uniform(r, uint64(j))
+		if err != nil {
+			return nil, err
+		}
+		i := int64(t) + 1
+		if chosen[i] {
+			i = j
+		}
+		chosen[i] = true
+		indices = append(indices, i)
+	}
+	sort.Slice(indices, func(a, b int) bool { return indices[a] < indices[b] })
+	return indices, nil
+}
+
+// newChallenge draws a challenge over n blocks from the randomness in r; the
+// coefficients are non-zero 32-bit integers.
+func newChallenge(r io.Reader, n int64, spec ChallengeSpec) (Challenge, error) {
+	l, confidence, err := spec.size(n)
+	if err != nil {
+		return Challenge{}, err
+	}
+	indices, err := sampleIndices(r, l, n)
+	if err != nil {
+		return Challenge{}, err
+	}
+	q := make([]QElement, l)
+	for k, i := range indices {
+		v, err := uniform(r, 1<<32-1)
+		if err != nil {
+			return Challenge{}, err
+		}
+		q[k] = QElement{I: i, V: int64(v) + 1}
+	}
+	return Challenge{Q: q, Confidence: confidence}, nil
+}
+
+// prfStream is the keystream HMAC-SHA512(seed, "por-challenge" || counter)
+// for counter = 0, 1, 2, ...
+type prfStream struct {
+	mac     hash.Hash
+	counter uint64
+	buf     []byte
+}
+
+func newPRFStream(seed []byte) *prfStream {
+	return &prfStream{mac: hmac.New(sha512.New, seed)}
+}
+
+func (p *prfStream) Read(b []byte) (int, error) {
+	for len(p.buf) < len(b) {
+		var counter [8]byte
+		binary.BigEndian.PutUint64(counter[:], p.counter)
+		p.counter++
+		p.mac.Reset()
+		p.mac.Write([]byte("por-challenge"))
+		p.mac.Write(counter[:])
+		p.buf = p.mac.Sum(p.buf)
+	}
+	k := copy(b, p.buf)
+	p.buf = p.buf[k:]
+	return k, nil
+}
+
+// NewSeededChallenge derives a challenge over n blocks from seed. The seed may
+// come from the verifier or from any public randomness both sides agree on.
+func NewSeededChallenge(seed []byte, n int64, spec ChallengeSpec) (Challenge, error) {
+	if len(seed) < MinSeedSize {
+		return Challenge{}, fmt.Errorf("%w: challenge seed shorter than %d bytes", ErrBadParams, MinSeedSize)
+	}
+	ch, err := newChallenge(newPRFStream(seed), n, spec)
+	if err != nil {
+		return Challenge{}, err
+	}
+	ch.Seed = append([]byte(nil), seed...)
+	ch.L, ch.N = int64(len(ch.Q)), n
+	return ch, nil
+}
+
+// newBoundChallenge draws a fresh seed and nonce and binds them to the file
+// tau_zero describes.
+func newBoundChallenge(tau_zero Tau_zero, spec ChallengeSpec) (Challenge, error) {
+	seed := make([]byte, 32)
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return Challenge{}, fmt.Errorf("%w: %v", ErrRandomness, err)
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return Challenge{}, fmt.Errorf("%w: %v", ErrRandomness, err)
+	}
+	ch, err := NewSeededChallenge(seed, tau_zero.n, tau_zero.codeSpec(spec))
+	if err != nil {
+		return Challenge{}, err
+	}
+	ch.Nonce, ch.FileID = nonce, tau_zero.ID()
+	if spec.Lifetime > 0 {
+		ch.Deadline = time.Now().Add(spec.Lifetime).Round(0)
+	}
+	ch.Q = nil
+	if err := ch.Expand(); err != nil {
+		return Challenge{}, err
+	}
+	return ch, nil
+}
+
+// ID identifies the file tau_zero describes in bound challenges.
+func (t Tau_zero) ID() []byte {
+	h := sha256.New()
+	h.Write([]byte("por-file-id"))
+	h.Write(t.name)
+	return h.Sum(nil)
+}
+
+func (c Challenge) bound() bool {
+	return len(c.Nonce) > 0 || len(c.FileID) > 0 || !c.Deadline.IsZero()
+}
+
+// expansionSeed is the seed the pairs are expanded from: Seed itself, or for a
+// bound challenge a hash of Seed, Nonce, FileID and Deadline.
+func (c Challenge) expansionSeed() []byte {
+	if !c.bound() {
+		return c.Seed
+	}
+	h := sha512.New()
+	h.Write([]byte("por-bound-challenge"))
+	var k [8]byte
+	for _, field := range [][]byte{c.Seed, c.Nonce, c.FileID} {
+		binary.BigEndian.PutUint64(k[:], uint64(len(field)))
+		h.Write(k[:])
+		h.Write(field)
+	}
+	binary.BigEndian.PutUint64(k[:], uint64(c.deadline()))
+	h.Write(k[:])
+	return h.Sum(nil)
+}
+
+// deadline returns Deadline in Unix nanoseconds, or 0 when there is none.
+func (c Challenge) deadline() int64 {
+	if c.Deadline.IsZero() {
+		return 0
+	}
+	return c.Deadline.UnixNano()
+}
+
+// Digest identifies c; a proof carries the digest of the challenge it answers.
+func (c Challenge) Digest() []byte {
+	data, _ := c.MarshalBinary()
+	digest := sha256.Sum256(data)
+	return digest[:]
+}
+
+// answerDigest is the digest a proof of c carries: that of c when it is
+// bound, none otherwise.
+func (c Challenge) answerDigest() []byte {
+	if !c.bound() {
+		return nil
+	}
+	return c.Digest()
+}
+
+// checkBinding checks that a bound challenge is meant for the file tau_zero
+// describes and has not passed its deadline.
+func checkBinding(ch Challenge, tau_zero Tau_zero) error {
+	if len(ch.FileID) > 0 && !bytes.Equal(ch.FileID, tau_zero.ID()) {
+		return ErrWrongFile
+	}
+	if !ch.Deadline.IsZero() && time.Now().After(ch.Deadline) {
+		return fmt.Errorf("%w: deadline was %v", ErrStaleChallenge, ch.Deadline.UTC())
+	}
+	return nil
+}
+
+// checkAnswers is checkBinding for a verifier, which also checks that the
+// digest carried by a proof names ch. The digest is required for bound
+// challenges only.
+func checkAnswers(ch Challenge, tau_zero Tau_zero, digest []byte) error {
+	if err := checkBinding(ch, tau_zero); err != nil {
+		return err
+	}
+	if (ch.bound() || len(digest) > 0) && !bytes.Equal(digest, ch.Digest()) {
+		return ErrChallengeMismatch
+	}
+	return nil
+}
+
+// Expand fills in Q from the seed of a challenge received in compact form.
+// It is a no-op for challenges that carry Q already.
+func (c *Challenge) Expand() error {
+	if c.Q != nil || len(c.Seed) == 0 {
+		return nil
+	}
+	if c.L < 1 || c.L > c.N {
+		return fmt.Errorf("%w: cannot expand %d blocks out of %d", ErrChallengeOutOfRange, c.L, c.N)
+	}
+	expanded, err := NewSeededChallenge(c.expansionSeed(), c.N, ChallengeSpec{L: c.L})
+	if err != nil {
+		return err
+	}
+	c.Q = expanded.Q
+	return nil
+}
+
+// elements returns the pairs of c for a file of n blocks, expanding a compact
+// challenge on the fly. A challenge drawn over some other number of blocks is
+// rejected before it is expanded, so L and N from the wire cannot make the
+// prover sample an arbitrary range.
+func (c Challenge) elements(n int64) ([]QElement, error) {
+	if (len(c.Seed) > 0 || c.N != 0) && c.N != n {
+		return nil, fmt.Errorf("%w: challenge drawn over %d blocks, file has %d", ErrChallengeOutOfRange, c.N, n)
+	}
+	if err := c.Expand(); err != nil {
+		return nil, err
+	}
+	return c.Q, nil
+}
@@ -0,0 +1,438 @@
+package por
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+)
+
+// Dynamic PoR
+//
+// St binds authenticator i to the position i through H(name || i), so changing
+// a single byte of a file means tagging it again. In the dynamic mode a block is
+// bound to its content instead:
+//
+//	sigma_i = (H(name || h_i) * prod_j u_j^m_ij)^d  mod N,   h_i = SHA-256(0x00 || m_i)
+//
+// and the order of the blocks is fixed by a Merkle tree over the leaves h_i,
+// whose root is signed together with Tau_zero. A proof carries, besides (mu,
+// sigma), the leaf and authentication path of every challenged block, so the
+// verifier learns h_i from the signed root. Updating, inserting or deleting a
+// block re-tags that block only and signs the new root.
+//
+// The verifier must keep the latest DynamicTau: an older one still verifies
+// against the blocks it was signed for.
+//
+// The storer keeps the blocks as a plain file, where every block but the last
+// is full, and makes each edit to it alongside the one made to the
+// DynamicFile; proofs read the challenged blocks from it through a
+// BlockSource. The DynamicFile itself only holds the leaves and authenticators.
+
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+func merkleLeaf(piece []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(piece)
+	return h.Sum(nil)
+}
+
+func merkleNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleLevels builds the tree over leaves, from the leaves up to the root. The
+// last node of an odd level is promoted unchanged.
+func merkleLevels(leaves [][]byte) [][][]byte {
+	levels := [][][]byte{leaves}
+	for level := leaves; len(level) > 1; {
+		next := make([][]byte, (len(level)+1)/2)
+		for x := range next {
+			if 2*x+1 < len(level) {
+				next[x] = merkleNode(level[2*x], level[2*x+1])
+			} else {
+				next[x] = level[2*x]
+			}
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels
+}
+
+func merkleRoot(levels [][][]byte) []byte {
+	top := levels[len(levels)-1]
+	if len(top) == 0 {
+		return merkleLeaf(nil)
+	}
+	return top[0]
+}
+
+// merklePath returns the siblings of leaf x, bottom up. Promoted nodes have no
+// sibling and add nothing to the path.
+func merklePath(levels [][][]byte, x int) [][]byte {
+	var path [][]byte
+	for _, level := range levels[:len(levels)-1] {
+		if x^1 < len(level) {
+			path = append(path, level[x^1])
+		}
+		x /= 2
+	}
+	return path
+}
+
+// verifyMerklePath reports whether path leads from leaf x of a tree of n
+// leaves to root.
+func verifyMerklePath(leaf []byte, x, n int64, path [][]byte, root []byte) bool {
+	if x < 0 || x >= n {
+		return false
+	}
+	node := leaf
+	for width := n; width > 1; width = (width + 1) / 2 {
+		if x^1 < width {
+			if len(path) == 0 {
+				return false
+			}
+			if x%2 == 0 {
+				node = merkleNode(node, path[0])
+			} else {
+				node = merkleNode(path[0], node)
+			}
+			path = path[1:]
+		}
+		x /= 2
+	}
+	return len(path) == 0 && bytes.Equal(node, root)
+}
+
+// hashNameLeaf is H(name || h_i), the dynamic counterpart of hashNameI.
+func hashNameLeaf(name []byte, leaf []byte) *big.Int {
+	h := sha512.New()
+	h.Write([]byte("por-dynamic"))
+	h.Write(name)
+	h.Write(leaf)
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// DynamicTau is the tag of a dynamic file: Tau_zero, with the current number
+// of blocks and size, and the Merkle root of the blocks.
+type DynamicTau struct {
+	Tau_zero
+	root      []byte
+	signature []byte
+}
+
+// Root returns the Merkle root of the tagged blocks.
+func (t DynamicTau) Root() []byte {
+	return t.root
+}
+
+// DynamicFile is what the storer keeps, besides the file, of a dynamic file to
+// update it and to answer challenges: the authenticators and the Merkle tree.
+type DynamicFile struct {
+	Tau            DynamicTau
+	Authenticators Authenticators
+	levels         [][][]byte
+}
+
+// DynamicProof answers a Challenge for a dynamic file. Leaves[k] and Paths[k]
+// authenticate the k-th challenged block against the signed root.
+type DynamicProof struct {
+	Proof  Proof
+	Leaves [][]byte
+	Paths  [][][]byte
+}
+
+// DynamicSt tags r as a dynamic file under ssk; the storer keeps the bytes of
+// r as the file. Dynamic files are not erasure coded, since one changed block
+// would change the parity of its whole group.
+func DynamicSt(ctx context.Context, ssk *rsa.PrivateKey, r io.Reader, params Params, opts StOptions) (*DynamicFile, error) {
+	if err := params.check(ssk.PublicKey.N); err != nil {
+		return nil, err
+	}
+	if params.coded() {
+		return nil, fmt.Errorf("%w: dynamic files are not erasure coded", ErrBadParams)
+	}
+	tau_zero := Tau_zero{Params: params}
+	tau_zero.name = make([]byte, 512)
+	if _, err := rand.Read(tau_zero.name); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRandomness, err)
+	}
+	tau_zero.U = make([]big.Int, params.S)
+	for j := range tau_zero.U {
+		u, err := rand.Int(rand.Reader, ssk.PublicKey.N)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRandomness, err)
+		}
+		tau_zero.U[j] = *u
+	}
+
+	// workers finish out of order, so leaves are collected by index
+	var lock sync.Mutex
+	var leaves [][]byte
+	counter := &countingReader{r: r}
+	f := &DynamicFile{}
+	n, err := tagBlocks(ctx, counter, params.BlockSize(), &f.Authenticators, opts, func(i int64, piece []byte) *big.Int {
+		leaf := merkleLeaf(piece)
+		lock.Lock()
+		for int64(len(leaves)) <= i {
+			leaves = append(leaves, nil)
+		}
+		leaves[i] = leaf
+		lock.Unlock()
+		return signBlock(hashNameLeaf(tau_zero.name, leaf), tau_zero, piece, ssk)
+	})
+	if err != nil {
+		return nil, err
+	}
+	tau_zero.n, tau_zero.size = n, counter.n
+
+	f.Tau.Tau_zero = tau_zero
+	f.levels = merkleLevels(leaves)
+	if err := f.sign(ssk); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// NewDynamicFile reassembles a DynamicFile from the stored file and
+// authenticators, rebuilding the Merkle tree and checking it against the root
+// in tau. The file is read one block at a time.
+func NewDynamicFile(tau DynamicTau, file BlockSource, authenticators Authenticators) (*DynamicFile, error) {
+	if file.Size() != tau.size || int64(len(authenticators)) != tau.n {
+		return nil, fmt.Errorf("%w: have %d bytes and %d authenticators for %d bytes in %d blocks", ErrShortRead, file.Size(), len(authenticators), tau.size, tau.n)
+	}
+	f := &DynamicFile{Tau: tau, Authenticators: authenticators}
+	leaves := make([][]byte, tau.n)
+	for x := range leaves {
+		piece, err := readBlockAt(file, tau.Params, tau.n, int64(x)+1)
+		if err != nil {
+			return nil, err
+		}
+		leaves[x] = merkleLeaf(piece)
+	}
+	f.levels = merkleLevels(leaves)
+	if !bytes.Equal(merkleRoot(f.levels), tau.root) {
+		return nil, fmt.Errorf("%w: blocks do not match the tagged root", ErrBadTagSignature)
+	}
+	return f, nil
+}
+
+// sign records the current root in the tag and signs it.
+func (f *DynamicFile) sign(ssk *rsa.PrivateKey) error {
+	f.Tau.root = merkleRoot(f.levels)
+	hashed := sha512.Sum512(f.Tau.signedBytes())
+	signature, err := rsa.SignPKCS1v15(nil, ssk, crypto.SHA512, hashed[:])
+	if err != nil {
+		return err
+	}
+	f.Tau.signature = signature
+	return nil
+}
+
+// padded returns block zero padded to a full block.
+func (f *DynamicFile) padded(block []byte) []byte {
+	piece := make([]byte, f.Tau.BlockSize())
+	copy(piece, block)
+	return piece
+}
+
+// lastSize returns the length of the last block.
+func (f *DynamicFile) lastSize() int64 {
+	return f.Tau.size - (f.Tau.n-1)*f.Tau.BlockSize()
+}
+
+// checkBlock checks that block can take a place in the file: the last block
+// holds 1 to BlockSize bytes, any other exactly BlockSize.
+func (f *DynamicFile) checkBlock(block []byte, last bool) error {
+	size := int64(len(block))
+	if size > f.Tau.BlockSize() || (!last && size < f.Tau.BlockSize()) || size == 0 {
+		return fmt.Errorf("%w: block of %d bytes where %d are expected", ErrBadParams, size, f.Tau.BlockSize())
+	}
+	return nil
+}
+
+// tagBlock returns the leaf and authenticator of block.
+func (f *DynamicFile) tagBlock(ssk *rsa.PrivateKey, block []byte) ([]byte, *big.Int) {
+	piece := f.padded(block)
+	leaf := merkleLeaf(piece)
+	return leaf, signBlock(hashNameLeaf(f.Tau.name, leaf), f.Tau.Tau_zero, piece, ssk)
+}
+
+// Update replaces block i (numbered from 1) with block, re-tagging it and
+// recomputing its path to the root. Only the last block may be short.
+func (f *DynamicFile) Update(ssk *rsa.PrivateKey, i int64, block []byte) error {
+	if i < 1 || i > f.Tau.n {
+		return fmt.Errorf("%w: block %d of %d", ErrChallengeOutOfRange, i, f.Tau.n)
+	}
+	if err := f.checkBlock(block, i == f.Tau.n); err != nil {
+		return err
+	}
+	leaf, sigma := f.tagBlock(ssk, block)
+	if i == f.Tau.n {
+		f.Tau.size += int64(len(block)) - f.lastSize()
+	}
+	f.Authenticators[i-1] = sigma
+
+	x := int(i - 1)
+	f.levels[0][x] = leaf
+	for l := 1; l < len(f.levels); l++ {
+		below := f.levels[l-1]
+		x /= 2
+		if 2*x+1 < len(below) {
+			f.levels[l][x] = merkleNode(below[2*x], below[2*x+1])
+		} else {
+			f.levels[l][x] = below[2*x]
+		}
+	}
+	return f.sign(ssk)
+}
+
+// Insert adds block so that it becomes block i, shifting the blocks from i on
+// by one; i may be n+1 to append. Only an appended block may be short, and
+// only after a full last block.
+func (f *DynamicFile) Insert(ssk *rsa.PrivateKey, i int64, block []byte) error {
+	if i < 1 || i > f.Tau.n+1 {
+		return fmt.Errorf("%w: block %d of %d", ErrChallengeOutOfRange, i, f.Tau.n)
+	}
+	if i == f.Tau.n+1 && f.Tau.n > 0 && f.lastSize() < f.Tau.BlockSize() {
+		return fmt.Errorf("%w: cannot append after a short last block", ErrBadParams)
+	}
+	if err := f.checkBlock(block, i == f.Tau.n+1); err != nil {
+		return err
+	}
+	leaf, sigma := f.tagBlock(ssk, block)
+	x := i - 1
+	f.Authenticators = append(f.Authenticators[:x], append(Authenticators{sigma}, f.Authenticators[x:]...)...)
+	leaves := append(append(append([][]byte(nil), f.levels[0][:x]...), leaf), f.levels[0][x:]...)
+	f.levels = merkleLevels(leaves)
+	f.Tau.n++
+	f.Tau.size += int64(len(block))
+	return f.sign(ssk)
+}
+
+// Delete removes block i, shifting the blocks after it down by one.
+func (f *DynamicFile) Delete(ssk *rsa.PrivateKey, i int64) error {
+	if i < 1 || i > f.Tau.n {
+		return fmt.Errorf("%w: block %d of %d", ErrChallengeOutOfRange, i, f.Tau.n)
+	}
+	x := i - 1
+	if i == f.Tau.n {
+		f.Tau.size -= f.lastSize()
+	} else {
+		f.Tau.size -= f.Tau.BlockSize()
+	}
+	f.Authenticators = append(f.Authenticators[:x], f.Authenticators[x+1:]...)
+	leaves := append(append([][]byte(nil), f.levels[0][:x]...), f.levels[0][x+1:]...)
+	f.levels = merkleLevels(leaves)
+	f.Tau.n--
+	return f.sign(ssk)
+}
+
+// verifyDynamicTag checks that tau was signed by the owner of spk.
+func verifyDynamicTag(tau DynamicTau, spk *rsa.PublicKey) error {
+	hashed := sha512.Sum512(tau.signedBytes())
+	if err := rsa.VerifyPKCS1v15(spk, crypto.SHA512, hashed[:], tau.signature); err != nil {
+		return ErrBadTagSignature
+	}
+	return nil
+}
+
+// DynamicChallenge checks the tag signature and draws a fresh bound challenge
+// over the current blocks.
+func DynamicChallenge(tau DynamicTau, spk *rsa.PublicKey, spec ChallengeSpec) (Challenge, error) {
+	if err := verifyDynamicTag(tau, spk); err != nil {
+		return Challenge{}, err
+	}
+	return newBoundChallenge(tau.Tau_zero, spec)
+}
+
+// Prove answers ch from file, the stored copy of the current blocks.
+func (f *DynamicFile) Prove(ch Challenge, spk *rsa.PublicKey, file BlockSource) (DynamicProof, error) {
+	if err := checkBinding(ch, f.Tau.Tau_zero); err != nil {
+		return DynamicProof{}, err
+	}
+	if file.Size() != f.Tau.size {
+		return DynamicProof{}, fmt.Errorf("%w: file has %d bytes, tag covers %d", ErrShortRead, file.Size(), f.Tau.size)
+	}
+	q, err := ch.elements(f.Tau.n)
+	if err != nil {
+		return DynamicProof{}, err
+	}
+	var proof DynamicProof
+	proof.Proof.Mu = make([]*big.Int, f.Tau.S)
+	for j := range proof.Proof.Mu {
+		proof.Proof.Mu[j] = big.NewInt(0)
+	}
+	sigma := new(big.Int).SetInt64(1)
+	for _, qelem := range q {
+		piece, err := readBlockAt(file, f.Tau.Params, f.Tau.n, qelem.I)
+		if err != nil {
+			return DynamicProof{}, err
+		}
+		v := new(big.Int).SetInt64(qelem.V)
+		for j := int64(0); j < f.Tau.S; j++ {
+			proof.Proof.Mu[j].Add(proof.Proof.Mu[j], new(big.Int).Mul(v, sector(piece, j, f.Tau.SectorSize)))
+		}
+		sigma.Mul(sigma, new(big.Int).Exp(f.Authenticators[qelem.I-1], v, spk.N))
+		sigma.Mod(sigma, spk.N)
+		proof.Leaves = append(proof.Leaves, f.levels[0][qelem.I-1])
+		proof.Paths = append(proof.Paths, merklePath(f.levels, int(qelem.I-1)))
+	}
+	proof.Proof.Sigma = canonicalSigma(sigma, spk.N)
+	proof.Proof.Challenge = ch.answerDigest()
+	return proof, nil
+}
+
+// DynamicVerify reports whether proof answers ch for the blocks under tau. As
+// with Verify_two, a wrong proof yields false and a malformed one an error.
+func DynamicVerify(tau DynamicTau, ch Challenge, proof DynamicProof, spk *rsa.PublicKey) (bool, error) {
+	if err := verifyDynamicTag(tau, spk); err != nil {
+		return false, err
+	}
+	q, err := ch.elements(tau.n)
+	if err != nil {
+		return false, err
+	}
+	mus, sigma := proof.Proof.Mu, proof.Proof.Sigma
+	if int64(len(mus)) != tau.S || int64(len(tau.U)) != tau.S || !isCanonicalSigma(sigma, spk.N) || len(proof.Leaves) != len(q) || len(proof.Paths) != len(q) {
+		return false, ErrMalformedProof
+	}
+	if err := checkAnswers(ch, tau.Tau_zero, proof.Proof.Challenge); err != nil {
+		return false, err
+	}
+
+	first := new(big.Int).SetInt64(1)
+	for k, qelem := range q {
+		if qelem.I < 1 || qelem.I > tau.n {
+			return false, fmt.Errorf("%w: block %d of %d", ErrChallengeOutOfRange, qelem.I, tau.n)
+		}
+		if !verifyMerklePath(proof.Leaves[k], qelem.I-1, tau.n, proof.Paths[k], tau.root) {
+			return false, nil
+		}
+		hash := hashNameLeaf(tau.name, proof.Leaves[k])
+		hash.Exp(hash, new(big.Int).SetInt64(qelem.V), spk.N)
+		first.Mul(first, hash)
+		first.Mod(first, spk.N)
+	}
+	second, err := uProduct(tau.U, mus, spk.N)
+	if err != nil {
+		return false, err
+	}
+	return equalUpToSign(new(big.Int).Exp(sigma, new(big.Int).SetInt64(int64(spk.E)), spk.N), new(big.Int).Mod(new(big.Int).Mul(first, second), spk.N), spk.N), nil
+}
@@ -0,0 +1,128 @@
+package por
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+// checkDynamic proves and verifies a challenge over the blocks of f, whose
+// stored copy is blocks, and checks that the file reopens from it.
+func checkDynamic(t *testing.T, f *DynamicFile, blocks [][]byte) {
+	t.Helper()
+	spk, _ := testKeys(t)
+	data := bytes.Join(blocks, nil)
+	if f.Tau.Blocks() != int64(len(blocks)) || f.Tau.size != int64(len(data)) {
+		t.Fatalf("tag covers %d bytes in %d blocks, file has %d in %d", f.Tau.size, f.Tau.Blocks(), len(data), len(blocks))
+	}
+	reopened, err := NewDynamicFile(f.Tau, BytesSource(data), f.Authenticators)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if len(blocks) == 0 {
+		return
+	}
+	ch, err := DynamicChallenge(f.Tau, spk, ChallengeSpec{L: int64(len(blocks))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []*DynamicFile{f, reopened} {
+		proof, err := g.Prove(ch, spk, BytesSource(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := DynamicVerify(f.Tau, ch, proof, spk); !ok || err != nil {
+			t.Fatalf("proof rejected: %v", err)
+		}
+	}
+}
+
+// randomBlock returns size random bytes.
+func randomBlock(t *testing.T, size int64) []byte {
+	t.Helper()
+	block := make([]byte, size)
+	if _, err := rand.Read(block); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestDynamicUpdates(t *testing.T) {
+	_, ssk := testKeys(t)
+	size := testParams.BlockSize()
+	data := testFile(t, 5)
+	f, err := DynamicSt(context.Background(), ssk, bytes.NewReader(data), testParams, StOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocks [][]byte
+	for len(data) > 0 {
+		k := int64(len(data))
+		if k > size {
+			k = size
+		}
+		blocks, data = append(blocks, data[:k]), data[k:]
+	}
+	checkDynamic(t, f, blocks)
+
+	// each step changes f and mirrors the change on the stored blocks
+	type step struct {
+		name  string
+		do    func() error
+		apply func()
+	}
+	middle, shorter, full := randomBlock(t, size), randomBlock(t, 5), randomBlock(t, size)
+	appended, first, only := randomBlock(t, 9), randomBlock(t, size), randomBlock(t, 3)
+	steps := []step{
+		{"update a middle block", func() error { return f.Update(ssk, 2, middle) }, func() { blocks[1] = middle }},
+		{"shorten the last block", func() error { return f.Update(ssk, 5, shorter) }, func() { blocks[4] = shorter }},
+		{"fill the last block", func() error { return f.Update(ssk, 5, full) }, func() { blocks[4] = full }},
+		{"append a short block", func() error { return f.Insert(ssk, 6, appended) }, func() { blocks = append(blocks, appended) }},
+		{"insert a first block", func() error { return f.Insert(ssk, 1, first) }, func() { blocks = append([][]byte{first}, blocks...) }},
+		{"delete a middle block", func() error { return f.Delete(ssk, 3) }, func() { blocks = append(blocks[:2], blocks[3:]...) }},
+		{"delete the last block", func() error { return f.Delete(ssk, 6) }, func() { blocks = blocks[:5] }},
+	}
+	for k := 0; k < 5; k++ {
+		steps = append(steps, step{"empty the file", func() error { return f.Delete(ssk, 1) }, func() { blocks = blocks[1:] }})
+	}
+	steps = append(steps, step{"append to an empty file", func() error { return f.Insert(ssk, 1, only) }, func() { blocks = append(blocks, only) }})
+
+	for _, s := range steps {
+		if err := s.do(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		s.apply()
+		checkDynamic(t, f, blocks)
+	}
+}
+
+func TestDynamicUpdateRejected(t *testing.T) {
+	_, ssk := testKeys(t)
+	size := testParams.BlockSize()
+	f, err := DynamicSt(context.Background(), ssk, bytes.NewReader(testFile(t, 3)), testParams, StOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, err := range map[string]error{
+		"short middle block":       f.Update(ssk, 2, randomBlock(t, size-1)),
+		"oversized last block":     f.Update(ssk, 3, randomBlock(t, size+1)),
+		"empty block":              f.Update(ssk, 3, nil),
+		"short inserted block":     f.Insert(ssk, 2, randomBlock(t, 1)),
+		"append after short block": f.Insert(ssk, 4, randomBlock(t, size)),
+	} {
+		if !errors.Is(err, ErrBadParams) {
+			t.Fatalf("%s: got %v", name, err)
+		}
+	}
+	for name, err := range map[string]error{
+		"update past the end": f.Update(ssk, 4, randomBlock(t, size)),
+		"insert past the end": f.Insert(ssk, 5, randomBlock(t, size)),
+		"delete block zero":   f.Delete(ssk, 0),
+	} {
+		if !errors.Is(err, ErrChallengeOutOfRange) {
+			t.Fatalf("%s: got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,880 @@
+package por
+
+// Wire format
+//
+// Tags, authenticator sets, challenges and proofs have a binary encoding
+// (MarshalBinary/UnmarshalBinary) and a JSON encoding (MarshalJSON/UnmarshalJSON).
+// Both carry a format version, currently 1.
+//
+// A binary encoding starts with a 4-byte magic and a 1-byte version. Integers
+// are big-endian and f64 is an IEEE 754 double; a byte string is a u32 length
+// followed by its bytes, and a big integer is the byte string of its
+// big-endian magnitude.
+//
+//	Tau            "PORT" ver | name bytes | n u64 | size u64 | S u64 |
+//	               SectorSize u64 | DataShards u64 | ParityShards u64 |
+//	               count u32 | count × U_j big | signature bytes
+//	PrivateTau     "PORV" ver | same fields as Tau, with count always 0 |
+//	               mac bytes
+//	Authenticators "PORA" ver | count u64 | count × sigma_i big (empty if missing)
+//	Challenge      "PORC" ver | confidence f64 | seeded u8 | then either
+//	               seed bytes | L u64 | N u64          (seeded = 1) or
+//	               count u32 | count × (I u64 | V u64) (seeded = 0) |
+//	               bound u8, then if bound = 1 nonce bytes | file id bytes |
+//	               deadline u64 (Unix nanoseconds, 0 for none)
+//	Proof          "PORP" ver | count u32 | count × mu_j big | sigma big |
+//	               bound u8, then if bound = 1 challenge digest bytes
+//	AggregateProof "PORG" ver | files u32 | files × (count u32 | count × mu_j big) |
+//	               sigma big
+//	DynamicTau     "PORD" ver | same fields as Tau | root bytes | signature bytes
+//	DynamicProof   "PODP" ver | Proof fields without the digest | count u32 |
+//	               count × (leaf bytes | path count u32 | path × node bytes) |
+//	               bound u8, then if bound = 1 challenge digest bytes
+//
+// The tag signature covers the Tau encoding up to and including the U
+// vector, with the magic "POR0" in place of "PORT". The signature of a
+// DynamicTau covers its encoding up to and including the root, with the magic
+// "POD0". A manifest signature covers
+//
+//	"PORM" ver | count u32 | count × (path bytes | size u64 | sha256 bytes |
+//	           Tau encoding bytes)
+//
+// In JSON, byte strings are base64 and big integers are lower-case hex strings.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+)
+
+const encodingVersion = 1
+
+var (
+	tauZeroMagic       = []byte("POR0")
+	tauMagic           = []byte("PORT")
+	privateTauMagic    = []byte("PORV")
+	authenticatorMagic = []byte("PORA")
+	challengeMagic     = []byte("PORC")
+	proofMagic         = []byte("PORP")
+	aggregateMagic     = []byte("PORG")
+	dynamicZeroMagic   = []byte("POD0")
+	dynamicTauMagic    = []byte("PORD")
+	dynamicProofMagic  = []byte("PODP")
+)
+
+// Proof is a prover's answer (mu, sigma) to a Challenge. Under the RSA scheme
+// sigma is the smaller of sigma and N - sigma (see canonicalSigma). Challenge
+// is the Digest of the challenge answered, for bound challenges.
+type Proof struct {
+	Mu        []*big.Int
+	Sigma     *big.Int
+	Challenge []byte
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func newEncoder(magic []byte) *encoder {
+	e := &encoder{}
+	e.buf.Write(magic)
+	e.buf.WriteByte(encodingVersion)
+	return e
+}
+
+func (e *encoder) u32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) u64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) bytes(p []byte) {
+	e.u32(uint32(len(p)))
+	e.buf.Write(p)
+}
+
+func (e *encoder) flag(b bool) {
+	if b {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) big(x *big.Int) {
+	if x == nil {
+		e.bytes(nil)
+		return
+	}
+	e.bytes(x.Bytes())
+}
+
+// decoder reads what encoder wrote. The first error sticks and every later
+// read returns zero values.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func newDecoder(data []byte, magic []byte) *decoder {
+	d := &decoder{data: data}
+	head := d.next(len(magic) + 1)
+	if d.err != nil {
+		return d
+	}
+	if !bytes.Equal(head[:len(magic)], magic) {
+		d.fail("bad magic")
+	} else if head[len(magic)] != encodingVersion {
+		d.fail(fmt.Sprintf("unsupported version %d", head[len(magic)]))
+	}
+	return d
+}
+
+func (d *decoder) fail(msg string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrBadEncoding, msg)
+	}
+}
+
+func (d *decoder) next(k int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if k < 0 || k > len(d.data) {
+		d.fail("truncated input")
+		return nil
+	}
+	p := d.data[:k]
+	d.data = d.data[k:]
+	return p
+}
+
+func (d *decoder) u32() uint32 {
+	p := d.next(4)
+	if p == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(p)
+}
+
+func (d *decoder) u64() uint64 {
+	p := d.next(8)
+	if p == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(p)
+}
+
+// int64 reads a u64 that must fit a non-negative int64.
+func (d *decoder) int64() int64 {
+	v := d.u64()
+	if v > 1<<63-1 {
+		d.fail("integer overflow")
+		return 0
+	}
+	return int64(v)
+}
+
+func (d *decoder) bytes() []byte {
+	k := d.u32()
+	p := d.next(int(k))
+	if p == nil {
+		return nil
+	}
+	return append([]byte(nil), p...)
+}
+
+// flag reads a u8 that must be 0 or 1.
+func (d *decoder) flag() bool {
+	p := d.next(1)
+	if p == nil {
+		return false
+	}
+	if p[0] > 1 {
+		d.fail("bad flag")
+	}
+	return p[0] == 1
+}
+
+// digest reads the non-empty challenge digest of a proof.
+func (d *decoder) digest() []byte {
+	p := d.bytes()
+	if d.err == nil && len(p) == 0 {
+		d.fail("empty challenge digest")
+	}
+	return p
+}
+
+func (d *decoder) big() *big.Int {
+	return new(big.Int).SetBytes(d.bytes())
+}
+
+// count reads a u32 element count and checks that at least min bytes per
+// element are left, so a corrupt count cannot trigger a huge allocation.
+func (d *decoder) count(min int) int {
+	k := d.u32()
+	if d.err == nil && int(k) > len(d.data)/min {
+		d.fail("element count exceeds input")
+		return 0
+	}
+	return int(k)
+}
+
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.data) != 0 {
+		d.fail("trailing bytes")
+	}
+	return d.err
+}
+
+func (t Tau_zero) encode(e *encoder) {
+	e.bytes(t.name)
+	e.u64(uint64(t.n))
+	e.u64(uint64(t.size))
+	e.u64(uint64(t.S))
+	e.u64(uint64(t.SectorSize))
+	e.u64(uint64(t.DataShards))
+	e.u64(uint64(t.ParityShards))
+	e.u32(uint32(len(t.U)))
+	for j := range t.U {
+		e.big(&t.U[j])
+	}
+}
+
+func (t *Tau_zero) decode(d *decoder) {
+	t.name = d.bytes()
+	t.n = d.int64()
+	t.size = d.int64()
+	t.S = d.int64()
+	t.SectorSize = d.int64()
+	t.DataShards = d.int64()
+	t.ParityShards = d.int64()
+	count := d.count(4)
+	t.U = make([]big.Int, count)
+	for j := range t.U {
+		t.U[j].Set(d.big())
+	}
+}
+
+// signedBytes is the message covered by the tag signature.
+func (t Tau_zero) signedBytes() []byte {
+	e := newEncoder(tauZeroMagic)
+	t.encode(e)
+	return e.buf.Bytes()
+}
+
+// Name returns the random file name bound into every authenticator.
+func (t Tau_zero) Name() []byte {
+	return t.name
+}
+
+// Blocks returns the number of tagged blocks.
+func (t Tau_zero) Blocks() int64 {
+	return t.n
+}
+
+// Size returns the length of the original file in bytes.
+func (t Tau_zero) Size() int64 {
+	return t.size
+}
+
+func (t Tau) MarshalBinary() ([]byte, error) {
+	e := newEncoder(tauMagic)
+	t.Tau_zero.encode(e)
+	e.bytes(t.signature)
+	return e.buf.Bytes(), nil
+}
+
+func (t *Tau) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data, tauMagic)
+	var tau Tau
+	tau.Tau_zero.decode(d)
+	tau.signature = d.bytes()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*t = tau
+	return nil
+}
+
+func (t PrivateTau) MarshalBinary() ([]byte, error) {
+	e := newEncoder(privateTauMagic)
+	t.Tau_zero.encode(e)
+	e.bytes(t.mac)
+	return e.buf.Bytes(), nil
+}
+
+func (t *PrivateTau) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data, privateTauMagic)
+	var tau PrivateTau
+	tau.Tau_zero.decode(d)
+	tau.mac = d.bytes()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*t = tau
+	return nil
+}
+
+func (a Authenticators) MarshalBinary() ([]byte, error) {
+	e := newEncoder(authenticatorMagic)
+	e.u64(uint64(len(a)))
+	for _, sigma := range a {
+		e.big(sigma)
+	}
+	return e.buf.Bytes(), nil
+}
+
+func (a *Authenticators) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data, authenticatorMagic)
+	count := d.u64()
+	if d.err == nil && count > uint64(len(d.data)/4) {
+		d.fail("element count exceeds input")
+	}
+	sigmas := make(Authenticators, 0, count)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		p := d.bytes()
+		if len(p) == 0 {
+			sigmas = append(sigmas, nil)
+			continue
+		}
+		sigmas = append(sigmas, new(big.Int).SetBytes(p))
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*a = sigmas
+	return nil
+}
+
+func (c Challenge) MarshalBinary() ([]byte, error) {
+	e := newEncoder(challengeMagic)
+	e.u64(math.Float64bits(c.Confidence))
+	if len(c.Seed) > 0 {
+		e.buf.WriteByte(1)
+		e.bytes(c.Seed)
+		e.u64(uint64(c.L))
+		e.u64(uint64(c.N))
+	} else {
+		e.buf.WriteByte(0)
+		e.u32(uint32(len(c.Q)))
+		for _, q := range c.Q {
+			e.u64(uint64(q.I))
+			e.u64(uint64(q.V))
+		}
+	}
+	e.flag(c.bound())
+	if c.bound() {
+		e.bytes(c.Nonce)
+		e.bytes(c.FileID)
+		e.u64(uint64(c.deadline()))
+	}
+	return e.buf.Bytes(), nil
+}
+
+func (c *Challenge) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data, challengeMagic)
+	ch := Challenge{Confidence: math.Float64frombits(d.u64())}
+	seeded := d.next(1)
+	switch {
+	case seeded == nil:
+	case seeded[0] == 1:
+		ch.Seed = d.bytes()
+		ch.L = d.int64()
+		ch.N = d.int64()
+	case seeded[0] == 0:
+		ch.Q = make([]QElement, d.count(16))
+		for k := range ch.Q {
+			ch.Q[k].I = d.int64()
+			ch.Q[k].V = d.int64()
+		}
+	default:
+		d.fail("bad challenge form")
+	}
+	if d.flag() {
+		ch.Nonce = d.bytes()
+		ch.FileID = d.bytes()
+		if deadline := d.int64(); deadline != 0 {
+			ch.Deadline = time.Unix(0, deadline)
+		}
+		if !ch.bound() {
+			d.fail("empty binding")
+		}
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*c = ch
+	return nil
+}
+
+func (p Proof) MarshalBinary() ([]byte, error) {
+	e := newEncoder(proofMagic)
+	e.u32(uint32(len(p.Mu)))
+	for _, mu := range p.Mu {
+		e.big(mu)
+	}
+	e.big(p.Sigma)
+	e.flag(len(p.Challenge) > 0)
+	if len(p.Challenge) > 0 {
+		e.bytes(p.Challenge)
+	}
+	return e.buf.Bytes(), nil
+}
+
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data, proofMagic)
+	mu := make([]*big.Int, d.count(4))
+	for j := range mu {
+		mu[j] = d.big()
+	}
+	sigma := d.big()
+	var digest []byte
+	if d.flag() {
+		digest = d.digest()
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+	p.Mu, p.Sigma, p.Challenge = mu, sigma, digest
+	return nil
+}
+
+func (p AggregateProof) MarshalBinary() ([]byte, error) {
+	e := newEncoder(aggregateMagic)
+	e.u32(uint32(len(p.Mu)))
+	for _, mus := range p.Mu {
+		e.u32(uint32(len(mus)))
+		for _, mu := range mus {
+			e.big(mu)
+		}
+	}
+	e.big(p.Sigma)
+	return e.buf.Bytes(), nil
+}
+
+func (p *AggregateProof) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data, aggregateMagic)
+	mu := make([][]*big.Int, d.count(4))
+	for f := range mu {
+		mu[f] = make([]*big.Int, d.count(4))
+		for j := range mu[f] {
+			mu[f][j] = d.big()
+		}
+	}
+	sigma := d.big()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	p.Mu, p.Sigma = mu, sigma
+	return nil
+}
+
+// signedBytes is the message covered by the signature of a dynamic tag.
+func (t DynamicTau) signedBytes() []byte {
+	e := newEncoder(dynamicZeroMagic)
+	t.Tau_zero.encode(e)
+	e.bytes(t.root)
+	return e.buf.Bytes()
+}
+
+func (t DynamicTau) MarshalBinary() ([]byte, error) {
+	e := newEncoder(dynamicTauMagic)
+	t.Tau_zero.encode(e)
+	e.bytes(t.root)
+	e.bytes(t.signature)
+	return e.buf.Bytes(), nil
+}
+
+func (t *DynamicTau) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data, dynamicTauMagic)
+	var tau DynamicTau
+	tau.Tau_zero.decode(d)
+	tau.root = d.bytes()
+	tau.signature = d.bytes()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*t = tau
+	return nil
+}
+
+func (p DynamicProof) MarshalBinary() ([]byte, error) {
+	e := newEncoder(dynamicProofMagic)
+	e.u32(uint32(len(p.Proof.Mu)))
+	for _, mu := range p.Proof.Mu {
+		e.big(mu)
+	}
+	e.big(p.Proof.Sigma)
+	e.u32(uint32(len(p.Leaves)))
+	for k, leaf := range p.Leaves {
+		e.bytes(leaf)
+		var path [][]byte
+		if k < len(p.Paths) {
+			path = p.Paths[k]
+		}
+		e.u32(uint32(len(path)))
+		for _, node := range path {
+			e.bytes(node)
+		}
+	}
+	e.flag(len(p.Proof.Challenge) > 0)
+	if len(p.Proof.Challenge) > 0 {
+		e.bytes(p.Proof.Challenge)
+	}
+	return e.buf.Bytes(), nil
+}
+
+func (p *DynamicProof) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data, dynamicProofMagic)
+	var proof DynamicProof
+	proof.Proof.Mu = make([]*big.Int, d.count(4))
+	for j := range proof.Proof.Mu {
+		proof.Proof.Mu[j] = d.big()
+	}
+	proof.Proof.Sigma = d.big()
+	proof.Leaves = make([][]byte, d.count(8))
+	proof.Paths = make([][][]byte, len(proof.Leaves))
+	for k := range proof.Leaves {
+		proof.Leaves[k] = d.bytes()
+		proof.Paths[k] = make([][]byte, d.count(4))
+		for x := range proof.Paths[k] {
+			proof.Paths[k][x] = d.bytes()
+		}
+	}
+	if d.flag() {
+		proof.Proof.Challenge = d.digest()
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*p = proof
+	return nil
+}
+
+// hexInt is a big integer that travels as a hex string in JSON.
+type hexInt struct {
+	*big.Int
+}
+
+func (h hexInt) MarshalJSON() ([]byte, error) {
+	if h.Int == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(h.Text(16))
+}
+
+func (h *hexInt) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		h.Int = nil
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	x, ok := new(big.Int).SetString(s, 16)
+	if !ok || x.Sign() < 0 {
+		return fmt.Errorf("%w: bad hex integer %q", ErrBadEncoding, s)
+	}
+	h.Int = x
+	return nil
+}
+
+func toHex(xs []*big.Int) []hexInt {
+	hs := make([]hexInt, len(xs))
+	for k, x := range xs {
+		hs[k] = hexInt{x}
+	}
+	return hs
+}
+
+func fromHex(hs []hexInt) []*big.Int {
+	xs := make([]*big.Int, len(hs))
+	for k, h := range hs {
+		xs[k] = h.Int
+	}
+	return xs
+}
+
+func checkVersion(v int) error {
+	if v != encodingVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrBadEncoding, v)
+	}
+	return nil
+}
+
+type tauJSON struct {
+	Version      int      `json:"version"`
+	Name         []byte   `json:"name"`
+	N            int64    `json:"n"`
+	Size         int64    `json:"size"`
+	S            int64    `json:"s"`
+	SectorSize   int64    `json:"sector_size"`
+	DataShards   int64    `json:"data_shards,omitempty"`
+	ParityShards int64    `json:"parity_shards,omitempty"`
+	U            []hexInt `json:"u"`
+	Signature    []byte   `json:"signature"`
+}
+
+func (t Tau_zero) toJSON(signature []byte) tauJSON {
+	u := make([]hexInt, len(t.U))
+	for j := range t.U {
+		u[j] = hexInt{&t.U[j]}
+	}
+	return tauJSON{
+		Version:      encodingVersion,
+		Name:         t.name,
+		N:            t.n,
+		Size:         t.size,
+		S:            t.S,
+		SectorSize:   t.SectorSize,
+		DataShards:   t.DataShards,
+		ParityShards: t.ParityShards,
+		U:            u,
+		Signature:    signature,
+	}
+}
+
+func (v tauJSON) tauZero() (Tau_zero, error) {
+	if err := checkVersion(v.Version); err != nil {
+		return Tau_zero{}, err
+	}
+	t := Tau_zero{name: v.Name, n: v.N, size: v.Size}
+	t.Params = Params{S: v.S, SectorSize: v.SectorSize, DataShards: v.DataShards, ParityShards: v.ParityShards}
+	t.U = make([]big.Int, len(v.U))
+	for j, h := range v.U {
+		if h.Int == nil {
+			return Tau_zero{}, fmt.Errorf("%w: missing U[%d]", ErrBadEncoding, j)
+		}
+		t.U[j].Set(h.Int)
+	}
+	return t, nil
+}
+
+func (t Tau) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Tau_zero.toJSON(t.signature))
+}
+
+func (t *Tau) UnmarshalJSON(data []byte) error {
+	var v tauJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	tau_zero, err := v.tauZero()
+	if err != nil {
+		return err
+	}
+	*t = Tau{Tau_zero: tau_zero, signature: v.Signature}
+	return nil
+}
+
+// A PrivateTau travels as a tauJSON with an empty u and its MAC in signature.
+func (t PrivateTau) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Tau_zero.toJSON(t.mac))
+}
+
+func (t *PrivateTau) UnmarshalJSON(data []byte) error {
+	var v tauJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	tau_zero, err := v.tauZero()
+	if err != nil {
+		return err
+	}
+	*t = PrivateTau{Tau_zero: tau_zero, mac: v.Signature}
+	return nil
+}
+
+type authenticatorsJSON struct {
+	Version int      `json:"version"`
+	Sigmas  []hexInt `json:"sigmas"`
+}
+
+func (a Authenticators) MarshalJSON() ([]byte, error) {
+	return json.Marshal(authenticatorsJSON{Version: encodingVersion, Sigmas: toHex(a)})
+}
+
+func (a *Authenticators) UnmarshalJSON(data []byte) error {
+	var v authenticatorsJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkVersion(v.Version); err != nil {
+		return err
+	}
+	*a = fromHex(v.Sigmas)
+	return nil
+}
+
+// A DynamicTau travels as a tauJSON with its Merkle root.
+type dynamicTauJSON struct {
+	tauJSON
+	Root []byte `json:"root"`
+}
+
+func (t DynamicTau) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dynamicTauJSON{tauJSON: t.Tau_zero.toJSON(t.signature), Root: t.root})
+}
+
+func (t *DynamicTau) UnmarshalJSON(data []byte) error {
+	var v dynamicTauJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	tau_zero, err := v.tauZero()
+	if err != nil {
+		return err
+	}
+	*t = DynamicTau{Tau_zero: tau_zero, root: v.Root, signature: v.Signature}
+	return nil
+}
+
+type qElementJSON struct {
+	I int64 `json:"i"`
+	V int64 `json:"v"`
+}
+
+type challengeJSON struct {
+	Version    int            `json:"version"`
+	Confidence float64        `json:"confidence"`
+	Seed       []byte         `json:"seed,omitempty"`
+	L          int64          `json:"l,omitempty"`
+	N          int64          `json:"n,omitempty"`
+	Q          []qElementJSON `json:"q,omitempty"`
+	Nonce      []byte         `json:"nonce,omitempty"`
+	FileID     []byte         `json:"file_id,omitempty"`
+	Deadline   *time.Time     `json:"deadline,omitempty"`
+}
+
+func (c Challenge) MarshalJSON() ([]byte, error) {
+	v := challengeJSON{Version: encodingVersion, Confidence: c.Confidence, Nonce: c.Nonce, FileID: c.FileID}
+	if !c.Deadline.IsZero() {
+		deadline := time.Unix(0, c.deadline()).UTC()
+		v.Deadline = &deadline
+	}
+	if len(c.Seed) > 0 {
+		v.Seed, v.L, v.N = c.Seed, c.L, c.N
+		return json.Marshal(v)
+	}
+	v.Q = make([]qElementJSON, len(c.Q))
+	for k, e := range c.Q {
+		v.Q[k] = qElementJSON{e.I, e.V}
+	}
+	return json.Marshal(v)
+}
+
+func (c *Challenge) UnmarshalJSON(data []byte) error {
+	var v challengeJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkVersion(v.Version); err != nil {
+		return err
+	}
+	ch := Challenge{Confidence: v.Confidence, Nonce: v.Nonce, FileID: v.FileID}
+	if v.Deadline != nil {
+		ch.Deadline = *v.Deadline
+	}
+	if len(v.Seed) > 0 {
+		ch.Seed, ch.L, ch.N = v.Seed, v.L, v.N
+	} else {
+		ch.Q = make([]QElement, len(v.Q))
+		for k, e := range v.Q {
+			ch.Q[k] = QElement{e.I, e.V}
+		}
+	}
+	*c = ch
+	return nil
+}
+
+type proofJSON struct {
+	Version   int      `json:"version"`
+	Mu        []hexInt `json:"mu"`
+	Sigma     hexInt   `json:"sigma"`
+	Challenge []byte   `json:"challenge,omitempty"`
+}
+
+func (p Proof) MarshalJSON() ([]byte, error) {
+	return json.Marshal(proofJSON{Version: encodingVersion, Mu: toHex(p.Mu), Sigma: hexInt{p.Sigma}, Challenge: p.Challenge})
+}
+
+func (p *Proof) UnmarshalJSON(data []byte) error {
+	var v proofJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkVersion(v.Version); err != nil {
+		return err
+	}
+	p.Mu, p.Sigma, p.Challenge = fromHex(v.Mu), v.Sigma.Int, v.Challenge
+	return nil
+}
+
+type aggregateProofJSON struct {
+	Version int        `json:"version"`
+	Mu      [][]hexInt `json:"mu"`
+	Sigma   hexInt     `json:"sigma"`
+}
+
+func (p AggregateProof) MarshalJSON() ([]byte, error) {
+	v := aggregateProofJSON{Version: encodingVersion, Mu: make([][]hexInt, len(p.Mu)), Sigma: hexInt{p.Sigma}}
+	for f, mus := range p.Mu {
+		v.Mu[f] = toHex(mus)
+	}
+	return json.Marshal(v)
+}
+
+func (p *AggregateProof) UnmarshalJSON(data []byte) error {
+	var v aggregateProofJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkVersion(v.Version); err != nil {
+		return err
+	}
+	p.Mu = make([][]*big.Int, len(v.Mu))
+	for f, mus := range v.Mu {
+		p.Mu[f] = fromHex(mus)
+	}
+	p.Sigma = v.Sigma.Int
+	return nil
+}
+
+type dynamicProofJSON struct {
+	proofJSON
+	Leaves [][]byte   `json:"leaves"`
+	Paths  [][][]byte `json:"paths"`
+}
+
+func (p DynamicProof) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dynamicProofJSON{
+		proofJSON: proofJSON{Version: encodingVersion, Mu: toHex(p.Proof.Mu), Sigma: hexInt{p.Proof.Sigma}, Challenge: p.Proof.Challenge},
+		Leaves:    p.Leaves,
+		Paths:     p.Paths,
+	})
+}
+
+func (p *DynamicProof) UnmarshalJSON(data []byte) error {
+	var v dynamicProofJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkVersion(v.Version); err != nil {
+		return err
+	}
+	p.Proof = Proof{Mu: fromHex(v.Mu), Sigma: v.Sigma.Int, Challenge: v.Challenge}
+	p.Leaves, p.Paths = v.Leaves, v.Paths
+	return nil
+}
@@ -0,0 +1,292 @@
+package por
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testKeysOnce sync.Once
+	testSPK      *rsa.PublicKey
+	testSSK      *rsa.PrivateKey
+	testKeysErr  error
+)
+
+// testKeys returns an RSA key pair shared by the tests of the package.
+func testKeys(t *testing.T) (*rsa.PublicKey, *rsa.PrivateKey) {
+	t.Helper()
+	testKeysOnce.Do(func() {
+		testSPK, testSSK, testKeysErr = Keygen(2048)
+	})
+	if testKeysErr != nil {
+		t.Fatal(testKeysErr)
+	}
+	return testSPK, testSSK
+}
+
+var testParams = Params{S: 4, SectorSize: 32}
+
+// testFile returns blocks blocks of random data, the last one short.
+func testFile(t *testing.T, blocks int) []byte {
+	t.Helper()
+	data := make([]byte, int64(blocks-1)*testParams.BlockSize()+17)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testTag tags a fresh file under the shared key.
+func testTag(t *testing.T) (Tau, Authenticators, []byte) {
+	t.Helper()
+	_, ssk := testKeys(t)
+	data := testFile(t, 6)
+	var authenticators Authenticators
+	tau, err := St(context.Background(), ssk, bytes.NewReader(data), testParams, &authenticators, StOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tau, authenticators, data
+}
+
+type codec interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+	json.Marshaler
+	json.Unmarshaler
+}
+
+// checkRoundTrip checks that v survives both encodings, that the JSON
+// encoding carries everything the binary one does, and that truncated input
+// or input with trailing bytes is rejected.
+func checkRoundTrip(t *testing.T, v codec, fresh func() codec) {
+	t.Helper()
+	data, err := v.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fresh()
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if again, _ := got.MarshalBinary(); !bytes.Equal(again, data) {
+		t.Fatal("binary encoding changed over a round trip")
+	}
+	for k := 0; k < len(data); k++ {
+		if err := fresh().UnmarshalBinary(data[:k]); !errors.Is(err, ErrBadEncoding) {
+			t.Fatalf("input truncated to %d of %d bytes: got %v", k, len(data), err)
+		}
+	}
+	for _, tail := range [][]byte{{0}, {1}, {0, 0, 0, 0}} {
+		if err := fresh().UnmarshalBinary(append(append([]byte(nil), data...), tail...)); !errors.Is(err, ErrBadEncoding) {
+			t.Fatalf("input with trailing %x: got %v", tail, err)
+		}
+	}
+
+	text, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = fresh()
+	if err := json.Unmarshal(text, got); err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	if again, _ := json.Marshal(got); !bytes.Equal(again, text) {
+		t.Fatalf("JSON encoding changed over a round trip:\n%s\n%s", text, again)
+	}
+	if again, _ := got.MarshalBinary(); !bytes.Equal(again, data) {
+		t.Fatal("JSON encoding lost fields of the binary one")
+	}
+	for k := 0; k < len(text); k++ {
+		if err := json.Unmarshal(text[:k], fresh()); err == nil {
+			t.Fatalf("JSON truncated to %d of %d bytes was accepted", k, len(text))
+		}
+	}
+	for _, tail := range []string{"x", "{}", "0"} {
+		if err := json.Unmarshal(append(append([]byte(nil), text...), tail...), fresh()); err == nil {
+			t.Fatalf("JSON with trailing %q was accepted", tail)
+		}
+	}
+}
+
+func TestTauRoundTrip(t *testing.T) {
+	tau, _, _ := testTag(t)
+	checkRoundTrip(t, &tau, func() codec { return new(Tau) })
+}
+
+func TestCodedTauRoundTrip(t *testing.T) {
+	_, ssk := testKeys(t)
+	key, err := CodeKeygen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := testParams
+	params.DataShards, params.ParityShards = 4, 2
+	var authenticators Authenticators
+	tau, err := StSource(context.Background(), ssk, BytesSource(testFile(t, 9)), params, &authenticators, StOptions{CodeKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRoundTrip(t, &tau, func() codec { return new(Tau) })
+}
+
+func TestPrivateTauRoundTrip(t *testing.T) {
+	key, err := PrivateKeygen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var authenticators Authenticators
+	tau, err := PrivateSt(context.Background(), key, bytes.NewReader(testFile(t, 5)), Params{S: 4, SectorSize: 31}, &authenticators, StOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRoundTrip(t, &tau, func() codec { return new(PrivateTau) })
+}
+
+func TestDynamicRoundTrip(t *testing.T) {
+	spk, ssk := testKeys(t)
+	data := testFile(t, 5)
+	f, err := DynamicSt(context.Background(), ssk, bytes.NewReader(data), testParams, StOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRoundTrip(t, &f.Tau, func() codec { return new(DynamicTau) })
+
+	ch, err := DynamicChallenge(f.Tau, spk, ChallengeSpec{L: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := f.Prove(ch, spk, BytesSource(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRoundTrip(t, &proof, func() codec { return new(DynamicProof) })
+}
+
+func TestAuthenticatorsRoundTrip(t *testing.T) {
+	_, authenticators, _ := testTag(t)
+	checkRoundTrip(t, &authenticators, func() codec { return new(Authenticators) })
+
+	missing := Authenticators{big.NewInt(5), nil, big.NewInt(7)}
+	checkRoundTrip(t, &missing, func() codec { return new(Authenticators) })
+}
+
+func TestChallengeRoundTrip(t *testing.T) {
+	spk, _ := testKeys(t)
+	tau, _, _ := testTag(t)
+
+	seeded, err := NewSeededChallenge(bytes.Repeat([]byte{7}, MinSeedSize), tau.Blocks(), ChallengeSpec{L: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicit := Challenge{Q: []QElement{{I: 1, V: 3}, {I: 4, V: 1<<32 - 1}}, Confidence: 0.5}
+	bound, err := Verify_one(tau, spk, ChallengeSpec{L: 3, Lifetime: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, ch := range map[string]Challenge{"seeded": seeded, "explicit": explicit, "bound": bound} {
+		ch := ch
+		t.Run(name, func(t *testing.T) {
+			checkRoundTrip(t, &ch, func() codec { return new(Challenge) })
+		})
+	}
+}
+
+func TestProofRoundTrip(t *testing.T) {
+	spk, _ := testKeys(t)
+	tau, authenticators, data := testTag(t)
+	unbound, err := NewSeededChallenge(bytes.Repeat([]byte{7}, MinSeedSize), tau.Blocks(), ChallengeSpec{L: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, err := Verify_one(tau, spk, ChallengeSpec{L: 2, Lifetime: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the proof of the bound challenge carries a digest
+	for _, ch := range []Challenge{unbound, bound} {
+		proof, err := Prove(tau, ch, authenticators, spk, BytesSource(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkRoundTrip(t, &proof, func() codec { return new(Proof) })
+	}
+}
+
+func TestAggregateProofRoundTrip(t *testing.T) {
+	spk, _ := testKeys(t)
+	var taus []Tau
+	var chs []Challenge
+	var authenticators []AuthenticatorSource
+	var files []BlockSource
+	for f := 0; f < 2; f++ {
+		tau, a, data := testTag(t)
+		ch, err := Verify_one(tau, spk, ChallengeSpec{L: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		taus, chs = append(taus, tau), append(chs, ch)
+		authenticators, files = append(authenticators, a), append(files, BytesSource(data))
+	}
+	proof, err := AggregateProve(taus, chs, authenticators, spk, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRoundTrip(t, &proof, func() codec { return new(AggregateProof) })
+}
+
+// TestDecodedProofVerifies checks that decoded tags, challenges and proofs
+// still verify.
+func TestDecodedProofVerifies(t *testing.T) {
+	spk, _ := testKeys(t)
+	tau, authenticators, data := testTag(t)
+	ch, err := Verify_one(tau, spk, ChallengeSpec{L: 4, Lifetime: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decodedTau Tau
+	text, _ := json.Marshal(tau)
+	if err := json.Unmarshal(text, &decodedTau); err != nil {
+		t.Fatal(err)
+	}
+	var decodedCh Challenge
+	raw, _ := ch.MarshalBinary()
+	if err := decodedCh.UnmarshalBinary(raw); err != nil {
+		t.Fatal(err)
+	}
+	proof, err := Prove(decodedTau, decodedCh, authenticators, spk, BytesSource(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decodedProof Proof
+	raw, _ = proof.MarshalBinary()
+	if err := decodedProof.UnmarshalBinary(raw); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Verify_two(tau, ch, decodedProof, spk); !ok || err != nil {
+		t.Fatalf("decoded proof rejected: %v", err)
+	}
+}
+
+func TestBadFlagRejected(t *testing.T) {
+	proof := Proof{Mu: []*big.Int{big.NewInt(1)}, Sigma: big.NewInt(2)}
+	raw, _ := proof.MarshalBinary()
+	raw[len(raw)-1] = 2
+	if err := new(Proof).UnmarshalBinary(raw); !errors.Is(err, ErrBadEncoding) {
+		t.Fatalf("got %v", err)
+	}
+	raw[len(raw)-1] = 1
+	if err := new(Proof).UnmarshalBinary(append(raw, 0, 0, 0, 0)); !errors.Is(err, ErrBadEncoding) {
+		t.Fatalf("empty digest: got %v", err)
+	}
+}
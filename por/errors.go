@@ -0,0 +1,26 @@
+package por
+
+import "errors"
+
+// Errors returned by the por package. A verifier can tell a misbehaving prover
+// (ErrBadTagSignature, ErrMalformedProof, ErrChallengeOutOfRange) apart from a
+// local fault such as ErrShortRead or ErrRandomness with errors.Is.
+var (
+	ErrBadParams           = errors.New("por: invalid block parameters")
+	ErrBadTagSignature     = errors.New("por: tag signature does not verify")
+	ErrShortRead           = errors.New("por: short read from file")
+	ErrChallengeOutOfRange = errors.New("por: challenge index out of range")
+	ErrMalformedProof      = errors.New("por: malformed proof")
+	ErrRandomness          = errors.New("por: reading randomness failed")
+	ErrBadEncoding         = errors.New("por: malformed encoding")
+	ErrBadKeySize          = errors.New("por: unsupported RSA key size")
+	ErrBadPassphrase       = errors.New("por: wrong passphrase or corrupt key file")
+	ErrBrokenChain         = errors.New("por: proof chain is not linked")
+	ErrUnknownScheme       = errors.New("por: unknown scheme")
+	ErrSchemeMismatch      = errors.New("por: key or tag belongs to another scheme")
+	ErrUnrecoverable       = errors.New("por: too many corrupt blocks to recover the file")
+	ErrKeyMismatch         = errors.New("por: authenticators belong to another key")
+	ErrStaleChallenge      = errors.New("por: challenge is past its deadline")
+	ErrChallengeMismatch   = errors.New("por: proof answers another challenge")
+	ErrWrongFile           = errors.New("por: challenge is for another file")
+)
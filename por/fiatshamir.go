@@ -0,0 +1,117 @@
+package por
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+)
+
+// Non-interactive audits
+//
+// Instead of waiting for a verifier, the storer derives the challenge of round
+// i from the tag, a hash of the chain so far and i itself. The chain value of
+// round i hashes that of round i-1 with the proof of round i-1, which is fixed
+// by its challenge and the file, so the storer has nothing to grind to steer a
+// later challenge away from the blocks it lost. The rounds of a deposit have
+// to be proved in order, and a verifier can later re-derive every challenge
+// and check the whole chain. Each proof is also committed to a CommitDAG, and
+// the label of its node recorded as the Commit of the round.
+
+// FiatShamirSeed returns the challenge seed of round, chained to prev.
+func FiatShamirSeed(tau Tau, prev []byte, round int64) []byte {
+	tag, _ := tau.MarshalBinary()
+	h := sha512.New()
+	h.Write([]byte("por-fiat-shamir"))
+	var k [8]byte
+	binary.BigEndian.PutUint64(k[:], uint64(len(tag)))
+	h.Write(k[:])
+	h.Write(tag)
+	binary.BigEndian.PutUint64(k[:], uint64(len(prev)))
+	h.Write(k[:])
+	h.Write(prev)
+	binary.BigEndian.PutUint64(k[:], uint64(round))
+	h.Write(k[:])
+	return h.Sum(nil)
+}
+
+// ChainNext returns the chain value of the round after the one that prev
+// seeded and proof answered.
+func ChainNext(prev []byte, proof Proof) []byte {
+	b, _ := proof.MarshalBinary()
+	h := sha512.New()
+	h.Write([]byte("por-chain"))
+	var k [8]byte
+	binary.BigEndian.PutUint64(k[:], uint64(len(prev)))
+	h.Write(k[:])
+	h.Write(prev)
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// FiatShamirChallenge is the challenge of round, chained to prev.
+func FiatShamirChallenge(tau Tau, prev []byte, round int64, spec ChallengeSpec) (Challenge, error) {
+	return NewSeededChallenge(FiatShamirSeed(tau, prev, round), tau.Tau_zero.n, tau.Tau_zero.codeSpec(spec))
+}
+
+// ChainLink is one round of a non-interactive audit: the proof answering the
+// challenge derived from Prev, and Commit, the label of the DAG node that
+// committed the proof.
+type ChainLink struct {
+	Round  int64
+	Prev   []byte
+	Proof  Proof
+	Commit []byte
+}
+
+// ProveChain answers rounds 1..rounds without a verifier. genesis seeds the
+// first round and each later round is seeded by ChainNext; commit stores each
+// proof (typically as a new CommitDAG node) and returns its label.
+func ProveChain(tau Tau, spk *rsa.PublicKey, authenticators AuthenticatorSource, file BlockSource, spec ChallengeSpec, genesis []byte, rounds int64, commit func(round int64, proof Proof) ([]byte, error)) ([]ChainLink, error) {
+	links := make([]ChainLink, 0, rounds)
+	prev := genesis
+	for round := int64(1); round <= rounds; round++ {
+		ch, err := FiatShamirChallenge(tau, prev, round, spec)
+		if err != nil {
+			return nil, err
+		}
+		proof, err := Prove(tau, ch, authenticators, spk, file)
+		if err != nil {
+			return nil, err
+		}
+		next, err := commit(round, proof)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, ChainLink{Round: round, Prev: prev, Proof: proof, Commit: next})
+		prev = ChainNext(prev, proof)
+	}
+	return links, nil
+}
+
+// VerifyChain re-derives the challenge of every round and checks its proof
+// and the linking of the rounds through ChainNext. It does not check that each
+// Commit really is the DAG node holding that round's proof; the caller does
+// that against the CommitDAG.
+func VerifyChain(tau Tau, spk *rsa.PublicKey, spec ChallengeSpec, genesis []byte, links []ChainLink) (bool, error) {
+	if err := verifyTag(tau, spk); err != nil {
+		return false, err
+	}
+	prev := genesis
+	for k, link := range links {
+		if link.Round != int64(k+1) || !bytes.Equal(link.Prev, prev) {
+			return false, fmt.Errorf("%w: round %d", ErrBrokenChain, k+1)
+		}
+		ch, err := FiatShamirChallenge(tau, prev, link.Round, spec)
+		if err != nil {
+			return false, err
+		}
+		ok, err := Verify_two(tau, ch, link.Proof, spk)
+		if err != nil || !ok {
+			return false, err
+		}
+		prev = ChainNext(prev, link.Proof)
+	}
+	return true, nil
+}
@@ -0,0 +1,33 @@
+package por
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	spk, _ := testKeys(t)
+	tau, authenticators, data := testTag(t)
+	spec := ChallengeSpec{L: 2}
+	genesis := []byte("genesis")
+	commit := func(round int64, proof Proof) ([]byte, error) {
+		b, err := proof.MarshalBinary()
+		h := sha256.Sum256(b)
+		return h[:], err
+	}
+	links, err := ProveChain(tau, spk, authenticators, BytesSource(data), spec, genesis, 4, commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyChain(tau, spk, spec, genesis, links); !ok || err != nil {
+		t.Fatalf("honest chain rejected: %v", err)
+	}
+
+	// the next round is seeded by the proof, not by the committed label
+	forged := append([]ChainLink(nil), links...)
+	forged[1].Prev = forged[0].Commit
+	if _, err := VerifyChain(tau, spk, spec, genesis, forged); !errors.Is(err, ErrBrokenChain) {
+		t.Fatalf("chain seeded by a commit: got %v", err)
+	}
+}
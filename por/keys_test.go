@@ -0,0 +1,104 @@
+package por
+
+import (
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrivateKeyRoundTrip(t *testing.T) {
+	spk, ssk := testKeys(t)
+	dir := t.TempDir()
+	for _, passphrase := range [][]byte{nil, []byte("correct horse battery staple")} {
+		path := filepath.Join(dir, "key.pem")
+		if err := SavePrivateKey(path, ssk, passphrase); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadPrivateKey(path, passphrase)
+		if err != nil {
+			t.Fatalf("passphrase %q: %v", passphrase, err)
+		}
+		if !loaded.Equal(ssk) {
+			t.Fatalf("passphrase %q: loaded another key", passphrase)
+		}
+	}
+
+	path := filepath.Join(dir, "key.pub")
+	if err := SavePublicKey(path, spk); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadPublicKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equal(spk) {
+		t.Fatal("loaded another public key")
+	}
+}
+
+func TestPrivateKeyWrongPassphrase(t *testing.T) {
+	_, ssk := testKeys(t)
+	data, err := MarshalPrivateKeyPEM(ssk, []byte("right"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePrivateKeyPEM(data, []byte("wrong")); !errors.Is(err, ErrBadPassphrase) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+// withKDFParams returns the encrypted key PEM data with its PBKDF2 parameters
+// rewritten by edit.
+func withKDFParams(t *testing.T, data []byte, edit func(*pbkdf2Params)) []byte {
+	t.Helper()
+	block, _ := pem.Decode(data)
+	var info encryptedPrivateKeyInfo
+	var params pbes2Params
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		t.Fatal(err)
+	}
+	edit(&kdf)
+	var err error
+	if params.KeyDerivationFunc.Parameters.FullBytes, err = asn1.Marshal(kdf); err != nil {
+		t.Fatal(err)
+	}
+	if info.Algorithm.Parameters.FullBytes, err = asn1.Marshal(params); err != nil {
+		t.Fatal(err)
+	}
+	if block.Bytes, err = asn1.Marshal(info); err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(block)
+}
+
+func TestPrivateKeyBadKDFParams(t *testing.T) {
+	_, ssk := testKeys(t)
+	passphrase := []byte("passphrase")
+	data, err := MarshalPrivateKeyPEM(ssk, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explicit := withKDFParams(t, data, func(kdf *pbkdf2Params) { kdf.KeyLength = pbkdf2KeySize })
+	if _, err := ParsePrivateKeyPEM(explicit, passphrase); err != nil {
+		t.Fatalf("explicit key length: %v", err)
+	}
+	for name, edit := range map[string]func(*pbkdf2Params){
+		"huge iteration count": func(kdf *pbkdf2Params) { kdf.Iterations = 1 << 40 },
+		"no iterations":        func(kdf *pbkdf2Params) { kdf.Iterations = 0 },
+		"short key length":     func(kdf *pbkdf2Params) { kdf.KeyLength = 16 },
+	} {
+		if _, err := ParsePrivateKeyPEM(withKDFParams(t, data, edit), passphrase); !errors.Is(err, ErrBadEncoding) {
+			t.Fatalf("%s: got %v", name, err)
+		}
+	}
+}
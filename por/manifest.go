@@ -0,0 +1,298 @@
+package por
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Manifests
+//
+// A deposit of many files is tagged under one key and described by a
+// manifest: for every regular file under a directory, its path relative to
+// the directory, its size, its SHA-256 and its tag. The storer signs the
+// manifest, so a verifier holding it and the public key can audit any subset
+// of the files, answered by a single aggregated proof.
+
+// ManifestEntry describes one tagged file. Path is slash separated and
+// relative to the tagged directory.
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 []byte `json:"sha256"`
+	Tau    Tau    `json:"tau"`
+}
+
+// Manifest lists the files of a tagged directory in lexical order of Path.
+type Manifest struct {
+	Entries   []ManifestEntry
+	signature []byte
+}
+
+var manifestMagic = []byte("PORM")
+
+// DirectoryOptions tunes TagDirectory.
+type DirectoryOptions struct {
+	StOptions
+	// Sink returns where the authenticators of the file at path go. A sink
+	// that is also an io.Closer is closed once the file is tagged.
+	Sink func(path string) (AuthenticatorSink, error)
+	// Encoded returns where the encoded copy of the file at path goes when
+	// params erasure code the files; the embedded StOptions.Encoded is ignored.
+	Encoded func(path string) (io.Writer, error)
+}
+
+// TagDirectory tags every regular file under root with ssk and returns the
+// signed manifest of the deposit.
+func TagDirectory(ctx context.Context, ssk *rsa.PrivateKey, root string, params Params, opts DirectoryOptions) (Manifest, error) {
+	if opts.Sink == nil {
+		return Manifest{}, fmt.Errorf("%w: no authenticator sink", ErrBadParams)
+	}
+	if params.coded() && opts.Encoded == nil {
+		return Manifest{}, fmt.Errorf("%w: erasure coded files need somewhere to store the encoded copies", ErrBadParams)
+	}
+	var m Manifest
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		entry, err := tagManifestFile(ctx, ssk, path, filepath.ToSlash(rel), params, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		m.Entries = append(m.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+	hashed := sha512.Sum512(m.signedBytes())
+	if m.signature, err = rsa.SignPKCS1v15(nil, ssk, crypto.SHA512, hashed[:]); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+func tagManifestFile(ctx context.Context, ssk *rsa.PrivateKey, path, rel string, params Params, opts DirectoryOptions) (_ ManifestEntry, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	defer file.Close()
+	sink, err := opts.Sink(rel)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	if closer, ok := sink.(io.Closer); ok {
+		defer func() {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+	stOpts := opts.StOptions
+	stOpts.Encoded = nil
+	if params.coded() {
+		if stOpts.Encoded, err = opts.Encoded(rel); err != nil {
+			return ManifestEntry{}, err
+		}
+	}
+
+	hash := sha256.New()
+	var tau Tau
+	if params.coded() {
+		// the code reads the file at random, so hash it on its own first
+		var src BlockSource
+		if src, err = FileSource(file); err != nil {
+			return ManifestEntry{}, err
+		}
+		if _, err = io.Copy(hash, io.NewSectionReader(src, 0, src.Size())); err != nil {
+			return ManifestEntry{}, err
+		}
+		tau, err = StSource(ctx, ssk, src, params, sink, stOpts)
+	} else {
+		tau, err = St(ctx, ssk, io.TeeReader(file, hash), params, sink, stOpts)
+	}
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	return ManifestEntry{Path: rel, Size: tau.size, SHA256: hash.Sum(nil), Tau: tau}, nil
+}
+
+// signedBytes is the message covered by the manifest signature.
+func (m Manifest) signedBytes() []byte {
+	e := newEncoder(manifestMagic)
+	e.u32(uint32(len(m.Entries)))
+	for _, entry := range m.Entries {
+		tau, _ := entry.Tau.MarshalBinary()
+		e.bytes([]byte(entry.Path))
+		e.u64(uint64(entry.Size))
+		e.bytes(entry.SHA256)
+		e.bytes(tau)
+	}
+	return e.buf.Bytes()
+}
+
+// VerifyManifest checks that m was signed by the owner of spk.
+func VerifyManifest(m Manifest, spk *rsa.PublicKey) error {
+	hashed := sha512.Sum512(m.signedBytes())
+	if err := rsa.VerifyPKCS1v15(spk, crypto.SHA512, hashed[:], m.signature); err != nil {
+		return ErrBadTagSignature
+	}
+	return nil
+}
+
+// Lookup returns the entry for path.
+func (m Manifest) Lookup(path string) (ManifestEntry, bool) {
+	for _, entry := range m.Entries {
+		if entry.Path == path {
+			return entry, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+type manifestJSON struct {
+	Version   int             `json:"version"`
+	Entries   []ManifestEntry `json:"entries"`
+	Signature []byte          `json:"signature"`
+}
+
+func (m Manifest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(manifestJSON{Version: encodingVersion, Entries: m.Entries, Signature: m.signature})
+}
+
+func (m *Manifest) UnmarshalJSON(data []byte) error {
+	var v manifestJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkVersion(v.Version); err != nil {
+		return err
+	}
+	m.Entries, m.signature = v.Entries, v.Signature
+	return nil
+}
+
+func SaveManifest(path string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func LoadManifest(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, fmt.Errorf("%w: %v", ErrBadEncoding, err)
+	}
+	return m, nil
+}
+
+// Audit is one audit session over a manifest: the files picked for it and a
+// challenge for each.
+type Audit struct {
+	Paths      []string    `json:"paths"`
+	Challenges []Challenge `json:"challenges"`
+}
+
+// NewAudit checks the manifest and draws challenges, sized by spec, for files
+// picked at random among its non-empty entries, or for all of them when files
+// exceeds their number. Empty files stay listed in the manifest with their
+// size and hash, but have no blocks to challenge.
+func NewAudit(m Manifest, spk *rsa.PublicKey, files int, spec ChallengeSpec) (Audit, error) {
+	if err := VerifyManifest(m, spk); err != nil {
+		return Audit{}, err
+	}
+	var auditable []int
+	for k, entry := range m.Entries {
+		if entry.Tau.Blocks() > 0 {
+			auditable = append(auditable, k)
+		}
+	}
+	if files < 1 || len(auditable) == 0 {
+		return Audit{}, fmt.Errorf("%w: audit covers no files", ErrBadParams)
+	}
+	if files > len(auditable) {
+		files = len(auditable)
+	}
+	picked, err := sampleIndices(rand.Reader, int64(files), int64(len(auditable)))
+	if err != nil {
+		return Audit{}, err
+	}
+	var audit Audit
+	for _, k := range picked {
+		entry := m.Entries[auditable[k-1]]
+		ch, err := Verify_one(entry.Tau, spk, spec)
+		if err != nil {
+			return Audit{}, fmt.Errorf("%s: %w", entry.Path, err)
+		}
+		audit.Paths = append(audit.Paths, entry.Path)
+		audit.Challenges = append(audit.Challenges, ch)
+	}
+	return audit, nil
+}
+
+// audited returns the tags of the files in audit.
+func (m Manifest) audited(audit Audit) ([]Tau, error) {
+	if len(audit.Challenges) != len(audit.Paths) {
+		return nil, fmt.Errorf("%w: %d paths and %d challenges", ErrBadParams, len(audit.Paths), len(audit.Challenges))
+	}
+	taus := make([]Tau, len(audit.Paths))
+	for k, path := range audit.Paths {
+		entry, ok := m.Lookup(path)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not in the manifest", ErrWrongFile, path)
+		}
+		taus[k] = entry.Tau
+	}
+	return taus, nil
+}
+
+// ProveAudit answers audit with one aggregated proof. open returns the
+// authenticators and the stored copy of the file at path; the caller keeps
+// ownership of both.
+func ProveAudit(m Manifest, audit Audit, spk *rsa.PublicKey, open func(path string) (AuthenticatorSource, BlockSource, error)) (AggregateProof, error) {
+	taus, err := m.audited(audit)
+	if err != nil {
+		return AggregateProof{}, err
+	}
+	authenticators := make([]AuthenticatorSource, len(taus))
+	files := make([]BlockSource, len(taus))
+	for k, path := range audit.Paths {
+		if authenticators[k], files[k], err = open(path); err != nil {
+			return AggregateProof{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return AggregateProve(taus, audit.Challenges, authenticators, spk, files)
+}
+
+// VerifyAudit reports whether proof answers audit for the files in m.
+func VerifyAudit(m Manifest, audit Audit, proof AggregateProof, spk *rsa.PublicKey) (bool, error) {
+	if err := VerifyManifest(m, spk); err != nil {
+		return false, err
+	}
+	taus, err := m.audited(audit)
+	if err != nil {
+		return false, err
+	}
+	return AggregateVerify(taus, audit.Challenges, proof, spk)
+}
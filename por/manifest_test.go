@@ -0,0 +1,79 @@
+package por
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// tagTestDirectory writes files under a fresh directory and tags it,
+// returning the manifest and the authenticators of every file.
+func tagTestDirectory(t *testing.T, files map[string][]byte) (Manifest, map[string]*Authenticators) {
+	t.Helper()
+	_, ssk := testKeys(t)
+	root := t.TempDir()
+	for path, data := range files {
+		full := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sinks := make(map[string]*Authenticators)
+	m, err := TagDirectory(context.Background(), ssk, root, testParams, DirectoryOptions{
+		Sink: func(path string) (AuthenticatorSink, error) {
+			sinks[path] = new(Authenticators)
+			return sinks[path], nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, sinks
+}
+
+func TestAuditSkipsEmptyFiles(t *testing.T) {
+	spk, _ := testKeys(t)
+	files := map[string][]byte{
+		"data":        testFile(t, 4),
+		"empty":       nil,
+		"sub/data":    testFile(t, 2),
+		"sub/nothing": {},
+	}
+	m, sinks := tagTestDirectory(t, files)
+	if len(m.Entries) != len(files) {
+		t.Fatalf("manifest lists %d of %d files", len(m.Entries), len(files))
+	}
+	if entry, ok := m.Lookup("empty"); !ok || entry.Size != 0 || entry.Tau.Blocks() != 0 {
+		t.Fatalf("empty file listed as %+v", entry)
+	}
+
+	audit, err := NewAudit(m, spk, len(files), ChallengeSpec{L: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := append([]string(nil), audit.Paths...)
+	sort.Strings(paths)
+	if len(paths) != 2 || paths[0] != "data" || paths[1] != "sub/data" {
+		t.Fatalf("audited %v", audit.Paths)
+	}
+	proof, err := ProveAudit(m, audit, spk, func(path string) (AuthenticatorSource, BlockSource, error) {
+		return *sinks[path], BytesSource(files[path]), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyAudit(m, audit, proof, spk); !ok || err != nil {
+		t.Fatalf("audit proof rejected: %v", err)
+	}
+
+	empty, _ := tagTestDirectory(t, map[string][]byte{"empty": nil})
+	if _, err := NewAudit(empty, spk, 1, ChallengeSpec{L: 2}); !errors.Is(err, ErrBadParams) {
+		t.Fatalf("directory of empty files: got %v", err)
+	}
+}
@@ -1,32 +1,77 @@
 package por
 
 import (
-	"bytes"
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha512"
 	"encoding/binary"
-	"encoding/gob"
+	"fmt"
+	"io"
 	"log"
-	"math"
 	"math/big"
-	"os"
+	"math/bits"
+	"runtime"
+	"sync"
 	"time"
 )
 
-func Keygen() (*rsa.PublicKey, *rsa.PrivateKey) {
-	ssk, err := rsa.GenerateKey(rand.Reader, 1024)
+// DefaultKeyBits is the RSA modulus size used when the caller has no
+// preference.
+const DefaultKeyBits = 2048
+
+// Keygen generates a storer key pair with a bits-long modulus; bits must be
+// 2048, 3072 or 4096.
+func Keygen(bits int) (*rsa.PublicKey, *rsa.PrivateKey, error) {
+	switch bits {
+	case 2048, 3072, 4096:
+	default:
+		return nil, nil, fmt.Errorf("%w: %d", ErrBadKeySize, bits)
+	}
+	ssk, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("%w: %v", ErrRandomness, err)
 	}
-	return &ssk.PublicKey, ssk
+	return &ssk.PublicKey, ssk, nil
+}
+
+// Params describes how a file is cut into blocks: every block holds S sectors
+// of SectorSize bytes each, and every sector is read as a big-endian integer
+// that must stay below the modulus of the scheme. When ParityShards is
+// positive the file is erasure coded before tagging, adding ParityShards
+// parity blocks to every DataShards blocks (see StOptions.CodeKey).
+type Params struct {
+	S            int64
+	SectorSize   int64
+	DataShards   int64
+	ParityShards int64
+}
+
+var DefaultParams = Params{S: 32, SectorSize: 64}
+
+func (p Params) BlockSize() int64 {
+	return p.S * p.SectorSize
 }
 
+func (p Params) check(modulus *big.Int) error {
+	if p.S < 1 || p.SectorSize < 1 {
+		return fmt.Errorf("%w: sector count and sector size must be positive", ErrBadParams)
+	}
+	if 8*p.SectorSize >= int64(modulus.BitLen()) {
+		return fmt.Errorf("%w: sector size does not fit below the modulus", ErrBadParams)
+	}
+	return p.checkCode()
+}
+
+// Tau_zero describes a tagged file: n blocks of the (possibly erasure coded)
+// stream of an original file of size bytes.
 type Tau_zero struct {
 	name []byte
 	n    int64
-	U    []big.Int
+	size int64
+	Params
+	U []big.Int
 }
 
 type Tau struct {
@@ -34,193 +79,542 @@ type Tau struct {
 	signature []byte
 }
 
-func Split(file *os.File) (M [][]byte, S int64, N int64) {
-	file.Seek(0, 0)
-	s := int64(1)
-
-	fileInfo, err := file.Stat()
-	if err != nil {
-		panic(err)
-	}
-	size := fileInfo.Size()
-	n := int64(math.Ceil(float64(size / s)))
-	// matrix is indexed as m_ij, so the first dimension has n items and the second has s.
-	matrix := make([][]byte, n)
-	for i := int64(0); i < n; i++ {
-		piece := make([]byte, s)
-		_, err := file.Read(piece)
-		if err != nil {
-			panic(err)
-		}
-		matrix[i] = piece
-	}
-	return matrix, s, n
+// sector returns m_ij, the j-th sector of a block, as an integer.
+func sector(piece []byte, j int64, sectorSize int64) *big.Int {
+	return new(big.Int).SetBytes(piece[j*sectorSize : (j+1)*sectorSize])
 }
 
+// hashNameI computes H(name || i) with i as a varint zero padded to 4 bytes,
+// so indices below 2^27 hash as they always have and larger ones do not panic.
 func hashNameI(name []byte, i int64) *big.Int {
-	i_bytes := make([]byte, 4)
-	binary.PutVarint(i_bytes, i)
-	hashArgument := append(name, i_bytes...)
+	i_bytes := make([]byte, binary.MaxVarintLen64)
+	k := binary.PutVarint(i_bytes, i)
+	if k < 4 {
+		k = 4
+	}
+	hashArgument := make([]byte, 0, len(name)+k)
+	hashArgument = append(append(hashArgument, name...), i_bytes[:k]...)
 	hash_array := sha512.Sum512(hashArgument)
 	return new(big.Int).SetBytes(hash_array[:])
 }
 
-func GenerateAuthenticator(i int64, s int64, tau_zero Tau_zero, piece []byte, ssk *rsa.PrivateKey) *big.Int {
-	hash_bigint := hashNameI(tau_zero.name, i+1)
+func GenerateAuthenticator(i int64, tau_zero Tau_zero, piece []byte, ssk *rsa.PrivateKey) *big.Int {
+	return signBlock(hashNameI(tau_zero.name, i+1), tau_zero, piece, ssk)
+}
 
+// signBlock computes (hash * prod_j u_j^m_ij)^d mod N.
+func signBlock(hash_bigint *big.Int, tau_zero Tau_zero, piece []byte, ssk *rsa.PrivateKey) *big.Int {
 	productory := big.NewInt(1)
-	for j := int64(0); j < s; j++ {
-		piece_bigint := new(big.Int).SetBytes([]byte{piece[j]})
-		productory.Mul(productory, new(big.Int).Exp(&tau_zero.U[j], piece_bigint, nil))
+	for j := int64(0); j < tau_zero.S; j++ {
+		productory.Mul(productory, new(big.Int).Exp(&tau_zero.U[j], sector(piece, j, tau_zero.SectorSize), ssk.PublicKey.N))
+		productory.Mod(productory, ssk.PublicKey.N)
 	}
 
 	innerProduct := new(big.Int).Mul(hash_bigint, productory)
 	return new(big.Int).Exp(innerProduct, ssk.D, ssk.PublicKey.N)
 }
 
-func St(ssk *rsa.PrivateKey, file *os.File) (_tau Tau, _sigma []*big.Int) {
-	matrix, s, n := Split(file)
-	tau_zero := Tau_zero{n: n}
+// AuthenticatorSink receives the authenticator of block i (numbered from 0) as
+// soon as it has been computed.
+type AuthenticatorSink interface {
+	Put(i int64, sigma *big.Int) error
+}
+
+// Authenticators keeps every authenticator in memory, indexed by block.
+type Authenticators []*big.Int
+
+func (a *Authenticators) Put(i int64, sigma *big.Int) error {
+	for int64(len(*a)) <= i {
+		*a = append(*a, nil)
+	}
+	(*a)[i] = sigma
+	return nil
+}
+
+// AuthenticatorSource gives the prover random access to the authenticator of
+// block i (numbered from 0), so only the challenged ones need be loaded.
+type AuthenticatorSource interface {
+	Authenticator(i int64) (*big.Int, error)
+	Len() int64
+}
+
+func (a Authenticators) Authenticator(i int64) (*big.Int, error) {
+	if i < 0 || i >= int64(len(a)) || a[i] == nil {
+		return nil, fmt.Errorf("%w: no authenticator for block %d", ErrChallengeOutOfRange, i+1)
+	}
+	return a[i], nil
+}
+
+func (a Authenticators) Len() int64 {
+	return int64(len(a))
+}
+
+// readBlock reads the next block from r, zero padding a final partial block.
+// It returns false once r is exhausted.
+func readBlock(r io.Reader, blockSize int64) ([]byte, bool, error) {
+	piece := make([]byte, blockSize)
+	k, err := io.ReadFull(r, piece)
+	if err == io.EOF {
+		return nil, false, nil
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, false, err
+	}
+	return piece, k > 0, nil
+}
+
+// readBlockAt reads block i (numbered from 1) of a file tagged as n blocks.
+// Only the last block may come up short; it is zero padded as in St.
+func readBlockAt(src BlockSource, params Params, n int64, i int64) ([]byte, error) {
+	if i < 1 || i > n {
+		return nil, fmt.Errorf("%w: block %d of %d", ErrChallengeOutOfRange, i, n)
+	}
+	blockSize := params.BlockSize()
+	offset := (i - 1) * blockSize
+	want := src.Size() - offset
+	if want > blockSize {
+		want = blockSize
+	}
+	if want <= 0 || (want < blockSize && i < n) {
+		return nil, fmt.Errorf("%w: block %d", ErrShortRead, i)
+	}
+	piece := make([]byte, blockSize)
+	k, err := src.ReadAt(piece[:want], offset)
+	if int64(k) == want {
+		return piece, nil
+	}
+	if err == nil || err == io.EOF {
+		return nil, fmt.Errorf("%w: block %d", ErrShortRead, i)
+	}
+	return nil, err
+}
+
+// StOptions tunes authenticator generation in St.
+type StOptions struct {
+	// Workers is the number of goroutines computing authenticators; zero
+	// means one per CPU.
+	Workers int
+	// Progress, when set, is called with the number of blocks tagged so far.
+	Progress func(blocks int64)
+	// Encoded, when set and the file is erasure coded, receives the encoded
+	// stream, which the prover must store instead of the original file.
+	Encoded io.Writer
+	// CodeKey is the owner's secret that shuffles and encrypts the blocks of
+	// an erasure coded file, at least MinCodeKeySize bytes (see CodeKeygen).
+	// Extract needs it again. Coded files are tagged with StSource.
+	CodeKey []byte
+}
+
+// tagInput returns the stream St tags for the file named name, along with the
+// size of the original file once the stream is read.
+type tagInput func(name []byte, params Params, opts StOptions) (io.Reader, func() int64, error)
+
+// streamInput tags the blocks of r as they are read.
+func streamInput(r io.Reader) tagInput {
+	return func(name []byte, params Params, opts StOptions) (io.Reader, func() int64, error) {
+		if params.coded() {
+			return nil, nil, fmt.Errorf("%w: erasure coding reads the file at random, tag it with StSource", ErrBadParams)
+		}
+		counter := &countingReader{r: r}
+		return counter, func() int64 { return counter.n }, nil
+	}
+}
+
+// sourceInput tags src, erasure coded under opts.CodeKey when params ask for
+// it.
+func sourceInput(src BlockSource) tagInput {
+	return func(name []byte, params Params, opts StOptions) (io.Reader, func() int64, error) {
+		if !params.coded() {
+			return streamInput(io.NewSectionReader(src, 0, src.Size()))(name, params, opts)
+		}
+		code, err := newFileCode(opts.CodeKey, name, params, src.Size())
+		if err != nil {
+			return nil, nil, err
+		}
+		var encoded io.Reader = &erasureReader{src: src, code: code}
+		if opts.Encoded != nil {
+			encoded = io.TeeReader(encoded, opts.Encoded)
+		}
+		return encoded, func() int64 { return code.size }, nil
+	}
+}
+
+// St tags the blocks read from r under ssk. Erasure coded params need random
+// access to the file; use StSource for them.
+func St(ctx context.Context, ssk *rsa.PrivateKey, r io.Reader, params Params, sink AuthenticatorSink, opts StOptions) (_tau Tau, _err error) {
+	return st(ctx, ssk, streamInput(r), params, sink, opts)
+}
+
+// StSource tags the file src like St, erasure coding it first when
+// params.ParityShards is positive.
+func StSource(ctx context.Context, ssk *rsa.PrivateKey, src BlockSource, params Params, sink AuthenticatorSink, opts StOptions) (Tau, error) {
+	return st(ctx, ssk, sourceInput(src), params, sink, opts)
+}
+
+func st(ctx context.Context, ssk *rsa.PrivateKey, input tagInput, params Params, sink AuthenticatorSink, opts StOptions) (Tau, error) {
+	if err := params.check(ssk.PublicKey.N); err != nil {
+		return Tau{}, err
+	}
+	s := params.S
+	tau_zero := Tau_zero{Params: params}
 
 	tau_zero.name = make([]byte, 512)
 	_, err := rand.Read(tau_zero.name)
 	if err != nil {
-		panic(err)
+		return Tau{}, fmt.Errorf("%w: %v", ErrRandomness, err)
 	}
 
 	tau_zero.U = make([]big.Int, s)
 	for i := int64(0); i < s; i++ {
 		result, err := rand.Int(rand.Reader, ssk.PublicKey.N)
 		if err != nil {
-			panic(err)
+			return Tau{}, fmt.Errorf("%w: %v", ErrRandomness, err)
 		}
 		tau_zero.U[i] = *result
 	}
 
-	var tau_zero_bytes bytes.Buffer
-	enc := gob.NewEncoder(&tau_zero_bytes)
-	err = enc.Encode(tau_zero)
+	encoded, size, err := input(tau_zero.name, params, opts)
 	if err != nil {
-		panic(err)
+		return Tau{}, err
 	}
-
-	hashed_t_0 := sha512.Sum512(tau_zero_bytes.Bytes())
-	t_0_signature, err := rsa.SignPKCS1v15(nil, ssk, crypto.SHA512, hashed_t_0[:])
+	n, err := tagBlocks(ctx, encoded, params.BlockSize(), sink, opts, func(i int64, piece []byte) *big.Int {
+		return GenerateAuthenticator(i, tau_zero, piece, ssk)
+	})
 	if err != nil {
-		panic(err)
+		return Tau{}, err
 	}
-	tau := Tau{Tau_zero: tau_zero, signature: t_0_signature}
+	tau_zero.n, tau_zero.size = n, size()
 
-	sigmas := make([]*big.Int, n)
-	// http://www.golangpatterns.info/concurrency/parallel-for-loop
-	sem := make(chan byte, n)
-	for i := int64(0); i < n; i++ {
-		go func(i int64) {
-			sigmas[i] = GenerateAuthenticator(i, s, tau_zero, matrix[i], ssk)
-			sem <- 0
-		}(i)
-	}
-	for i := int64(0); i < n; i++ {
-		<-sem
+	hashed_t_0 := sha512.Sum512(tau_zero.signedBytes())
+	t_0_signature, err := rsa.SignPKCS1v15(nil, ssk, crypto.SHA512, hashed_t_0[:])
+	if err != nil {
+		return Tau{}, err
 	}
-	return tau, sigmas
+	return Tau{Tau_zero: tau_zero, signature: t_0_signature}, nil
 }
 
-type QElement struct {
-	I int64
-	V int64
-}
+// tagBlocks streams the blocks of r through a fixed pool of workers running tag
+// and hands every result to sink. It returns the number of blocks read, or
+// ctx.Err() as soon as ctx is cancelled.
+func tagBlocks(ctx context.Context, r io.Reader, blockSize int64, sink AuthenticatorSink, opts StOptions, tag func(i int64, piece []byte) *big.Int) (int64, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-func Verify_one(tau Tau, spk *rsa.PublicKey) []QElement {
-	// Verifica che tau sia corretto
-	var tau_zero_bytes bytes.Buffer
-	enc := gob.NewEncoder(&tau_zero_bytes)
-	err := enc.Encode(tau.Tau_zero)
-	if err != nil {
-		panic(err)
+	type job struct {
+		i     int64
+		piece []byte
+	}
+	type result struct {
+		i     int64
+		sigma *big.Int
+	}
+	type readResult struct {
+		n   int64
+		err error
 	}
 
-	hashed_t_0 := sha512.Sum512(tau_zero_bytes.Bytes())
-	err = rsa.VerifyPKCS1v15(spk, crypto.SHA512, hashed_t_0[:], tau.signature)
-	if err != nil {
-		panic(err)
-	}
-
-	// l := tau.Tau_zero.n / 2
-	l := int64(2)
-	n_bigint := big.NewInt(tau.Tau_zero.n)
-	ret := make([]QElement, l)
-	for i := int64(0); i < l; i++ {
-		I_bignum := new(big.Int)
-		for {
-			I_bignum, err = rand.Int(rand.Reader, n_bigint)
-			if err != nil {
-				panic(err)
+	// the reader keeps at most one job per worker queued, so memory stays
+	// bounded by a few blocks per worker whatever the file size
+	jobs := make(chan job, workers)
+	read := make(chan readResult, 1)
+	go func() {
+		defer close(jobs)
+		for i := int64(0); ; i++ {
+			piece, ok, err := readBlock(r, blockSize)
+			if err != nil || !ok {
+				read <- readResult{i, err}
+				return
 			}
-			if I_bignum.Cmp(big.NewInt(0)) == +1 {
-				break
+			select {
+			case jobs <- job{i, piece}:
+			case <-wctx.Done():
+				read <- readResult{i, wctx.Err()}
+				return
 			}
 		}
-		ret[i].I = I_bignum.Int64()
+	}()
 
-		Q_bignum := new(big.Int)
-		for {
-			Q_bytes := make([]byte, 4)
-			_, err = rand.Read(Q_bytes)
-			if err != nil {
-				panic(err)
-			}
-			Q_bignum = new(big.Int).SetBytes(Q_bytes)
-			if Q_bignum.Cmp(big.NewInt(0)) == +1 {
-				break
+	results := make(chan result, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if wctx.Err() != nil {
+					return
+				}
+				select {
+				case results <- result{j.i, tag(j.i, j.piece)}:
+				case <-wctx.Done():
+					return
+				}
 			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var sinkErr error
+	done := int64(0)
+	for res := range results {
+		if sinkErr != nil || wctx.Err() != nil {
+			continue
+		}
+		if err := sink.Put(res.i, res.sigma); err != nil {
+			sinkErr = err
+			cancel()
+			continue
+		}
+		done++
+		if opts.Progress != nil {
+			opts.Progress(done)
 		}
-		ret[i].V = Q_bignum.Int64()
 	}
-	return ret
+	rr := <-read
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if sinkErr != nil {
+		return 0, sinkErr
+	}
+	if rr.err != nil {
+		return 0, rr.err
+	}
+	return rr.n, nil
 }
 
-func Prove(q []QElement, authenticators []*big.Int, spk *rsa.PublicKey, file *os.File) (_Mu []*big.Int, _Sigma *big.Int) {
+// Verify_one checks the tag signature and draws a fresh challenge sized by
+// spec, bound to a new nonce, the file and, if spec has a Lifetime, a deadline.
+func Verify_one(tau Tau, spk *rsa.PublicKey, spec ChallengeSpec) (Challenge, error) {
+	if err := verifyTag(tau, spk); err != nil {
+		return Challenge{}, err
+	}
+	return newBoundChallenge(tau.Tau_zero, spec)
+}
 
-	matrix, s, _ := Split(file)
+// verifyTag checks that tau was signed by the owner of spk.
+func verifyTag(tau Tau, spk *rsa.PublicKey) error {
+	// Verifica che tau sia corretto
+	hashed_t_0 := sha512.Sum512(tau.Tau_zero.signedBytes())
+	if err := rsa.VerifyPKCS1v15(spk, crypto.SHA512, hashed_t_0[:], tau.signature); err != nil {
+		return ErrBadTagSignature
+	}
+	return nil
+}
 
-	mu := make([]*big.Int, s)
-	for j := int64(0); j < s; j++ {
-		mu_j := big.NewInt(0)
-		for _, qelem := range q {
-			char := new(big.Int).SetBytes([]byte{matrix[qelem.I-1][j]})
+// proveMu computes mu_j = sum_i v_i m_ij over the challenged blocks, reduced
+// mod modulus unless it is nil. Only the challenged blocks are read.
+func proveMu(file BlockSource, params Params, n int64, q []QElement, modulus *big.Int) ([]*big.Int, error) {
+	mu := make([]*big.Int, params.S)
+	for j := range mu {
+		mu[j] = big.NewInt(0)
+	}
+	for _, qelem := range q {
+		piece, err := readBlockAt(file, params, n, qelem.I)
+		if err != nil {
+			return nil, err
+		}
+		for j := int64(0); j < params.S; j++ {
+			char := sector(piece, j, params.SectorSize)
 			product := new(big.Int).Mul(new(big.Int).SetInt64(qelem.V), char)
-			mu_j.Add(mu_j, product)
+			mu[j].Add(mu[j], product)
+		}
+	}
+	if modulus != nil {
+		for j := range mu {
+			mu[j].Mod(mu[j], modulus)
 		}
-		mu[j] = mu_j
+	}
+	return mu, nil
+}
+
+func Prove(tau Tau, ch Challenge, authenticators AuthenticatorSource, spk *rsa.PublicKey, file BlockSource) (Proof, error) {
+	if err := checkBinding(ch, tau.Tau_zero); err != nil {
+		return Proof{}, err
+	}
+	q, err := ch.elements(tau.n)
+	if err != nil {
+		return Proof{}, err
+	}
+	mu, err := proveMu(file, tau.Params, tau.n, q, nil)
+	if err != nil {
+		return Proof{}, err
 	}
 
 	sigma := new(big.Int).SetInt64(1)
 	for _, qelem := range q {
-		sigma.Mul(sigma, new(big.Int).Exp(authenticators[qelem.I-1], new(big.Int).SetInt64(qelem.V), spk.N))
+		sigma_i, err := authenticators.Authenticator(qelem.I - 1)
+		if err != nil {
+			return Proof{}, err
+		}
+		sigma.Mul(sigma, new(big.Int).Exp(sigma_i, new(big.Int).SetInt64(qelem.V), spk.N))
 	}
 	sigma.Mod(sigma, spk.N)
-	return mu, sigma
+	return Proof{Mu: mu, Sigma: canonicalSigma(sigma, spk.N), Challenge: ch.answerDigest()}, nil
 }
 
-func Verify_two(tau Tau, q []QElement, mus []*big.Int, sigma *big.Int, spk *rsa.PublicKey) bool {
+// Verify_two reports whether proof answers challenge ch. A proof that is well
+// formed but wrong yields false; an error means the proof or challenge could
+// not be checked at all. Sigma must be in canonical form, and then answers ch
+// when sigma^e = ±x (see canonicalSigma).
+func Verify_two(tau Tau, ch Challenge, proof Proof, spk *rsa.PublicKey) (bool, error) {
 	defer duration(track("Prove Runtime"))
-	first := new(big.Int).SetInt64(1)
-	for _, qelem := range q {
-		hash := hashNameI(tau.Tau_zero.name, qelem.I)
-		hash.Exp(hash, new(big.Int).SetInt64(qelem.V), spk.N)
-		first.Mul(first, hash)
+	if !isCanonicalSigma(proof.Sigma, spk.N) {
+		return false, ErrMalformedProof
+	}
+	if err := checkAnswers(ch, tau.Tau_zero, proof.Challenge); err != nil {
+		return false, err
+	}
+	expected, err := expectedSigma(tau, ch, proof.Mu, spk)
+	if err != nil {
+		return false, err
+	}
+	return equalUpToSign(new(big.Int).Exp(proof.Sigma, new(big.Int).SetInt64(int64(spk.E)), spk.N), expected, spk.N), nil
+}
+
+// canonicalSigma returns the smaller of sigma and N - sigma. Both satisfy the
+// verification equation up to sign, since e is odd; proofs carry the smaller
+// one, so exactly one sigma answers a challenge and a verifier need not tell
+// x from -x, which BatchVerify cannot do.
+func canonicalSigma(sigma, modulus *big.Int) *big.Int {
+	if neg := new(big.Int).Sub(modulus, sigma); neg.Cmp(sigma) < 0 {
+		return neg
+	}
+	return sigma
+}
+
+// isCanonicalSigma reports whether 0 < sigma < N - sigma.
+func isCanonicalSigma(sigma, modulus *big.Int) bool {
+	return sigma != nil && sigma.Sign() > 0 && new(big.Int).Lsh(sigma, 1).Cmp(modulus) < 0
+}
+
+// equalUpToSign reports whether y = ±x mod modulus, for y and x reduced.
+func equalUpToSign(y, x, modulus *big.Int) bool {
+	return y.Cmp(x) == 0 || new(big.Int).Add(y, x).Cmp(modulus) == 0
+}
+
+// expectedSigma checks that mus is well formed and returns the value sigma^e
+// must take for a proof (mus, sigma) to answer ch:
+// prod_i H(name || i)^v_i * prod_j u_j^mu_j mod N.
+func expectedSigma(tau Tau, ch Challenge, mus []*big.Int, spk *rsa.PublicKey) (*big.Int, error) {
+	if err := checkMu(tau, mus); err != nil {
+		return nil, err
+	}
+	first, err := hashProduct(tau, ch, spk)
+	if err != nil {
+		return nil, err
+	}
+	second, err := uProduct(tau.Tau_zero.U, mus, spk.N)
+	if err != nil {
+		return nil, err
+	}
+	return first.Mod(first.Mul(first, second), spk.N), nil
+}
+
+// checkMu checks that mus holds one non-negative mu_j per sector of tau.
+func checkMu(tau Tau, mus []*big.Int) error {
+	if int64(len(mus)) != tau.S || int64(len(tau.Tau_zero.U)) != tau.S {
+		return ErrMalformedProof
+	}
+	for _, mu := range mus {
+		if mu == nil || mu.Sign() < 0 {
+			return ErrMalformedProof
+		}
+	}
+	return nil
+}
+
+// hashProduct computes prod_i H(name || i)^v_i mod N over the pairs of ch.
+func hashProduct(tau Tau, ch Challenge, spk *rsa.PublicKey) (*big.Int, error) {
+	q, err := ch.elements(tau.n)
+	if err != nil {
+		return nil, err
 	}
-	first.Mod(first, spk.N)
+	hashes := make([]*big.Int, len(q))
+	vs := make([]uint64, len(q))
+	for k, qelem := range q {
+		if qelem.I < 1 || qelem.I > tau.n {
+			return nil, fmt.Errorf("%w: block %d of %d", ErrChallengeOutOfRange, qelem.I, tau.n)
+		}
+		if qelem.V < 0 {
+			return nil, fmt.Errorf("%w: coefficient %d of block %d", ErrChallengeOutOfRange, qelem.V, qelem.I)
+		}
+		hashes[k] = hashNameI(tau.Tau_zero.name, qelem.I)
+		vs[k] = uint64(qelem.V)
+	}
+	return multiExp(hashes, vs, spk.N), nil
+}
 
-	second := new(big.Int).SetInt64(1)
-	s := int64(1)
-	for j := int64(0); j < s; j++ {
-		second.Mul(second, new(big.Int).Exp(&tau.Tau_zero.U[j], mus[j], spk.N))
+// uProduct computes prod_j u_j^mu_j mod modulus.
+func uProduct(u []big.Int, mus []*big.Int, modulus *big.Int) (*big.Int, error) {
+	product := new(big.Int).SetInt64(1)
+	for j := range u {
+		if mus[j] == nil || mus[j].Sign() < 0 {
+			return nil, ErrMalformedProof
+		}
+		product.Mul(product, new(big.Int).Exp(&u[j], mus[j], modulus))
 	}
-	second.Mod(second, spk.N)
+	return product.Mod(product, modulus), nil
+}
 
-	return new(big.Int).Mod(new(big.Int).Mul(first, second), spk.N).Cmp(new(big.Int).Exp(sigma, new(big.Int).SetInt64(int64(spk.E)), spk.N)) == 0
+// multiExpWindow is the digit size, in bits, of multiExp.
+const multiExpWindow = 4
+
+// multiExp computes prod_k bases_k^exps_k mod modulus with the bucket method:
+// for every window of multiExpWindow exponent bits, each base is multiplied
+// into the bucket of its digit and the buckets are combined with running
+// products. That takes about one multiplication per base and window instead
+// of one squaring and up to one multiplication per base and bit, which is
+// what a separate exponentiation for each of the short coefficients of a
+// challenge costs.
+func multiExp(bases []*big.Int, exps []uint64, modulus *big.Int) *big.Int {
+	var max uint64
+	for _, x := range exps {
+		if x > max {
+			max = x
+		}
+	}
+	result := big.NewInt(1)
+	windows := (bits.Len64(max) + multiExpWindow - 1) / multiExpWindow
+	for w := windows - 1; w >= 0; w-- {
+		for k := 0; k < multiExpWindow && w < windows-1; k++ {
+			result.Mod(result.Mul(result, result), modulus)
+		}
+		buckets := make([]*big.Int, 1<<multiExpWindow)
+		for k, base := range bases {
+			d := exps[k] >> uint(w*multiExpWindow) & (1<<multiExpWindow - 1)
+			if d == 0 {
+				continue
+			}
+			if buckets[d] == nil {
+				buckets[d] = new(big.Int).Mod(base, modulus)
+			} else {
+				buckets[d].Mod(buckets[d].Mul(buckets[d], base), modulus)
+			}
+		}
+		// prod_d bucket_d^d as the product over d of prod_{d' >= d} bucket_d'
+		var running *big.Int
+		for d := len(buckets) - 1; d >= 1; d-- {
+			if buckets[d] != nil {
+				if running == nil {
+					running = buckets[d]
+				} else {
+					running.Mod(running.Mul(running, buckets[d]), modulus)
+				}
+			}
+			if running != nil {
+				result.Mod(result.Mul(result, running), modulus)
+			}
+		}
+	}
+	return result
 }
 
 func track(msg string) (string, time.Time) {
@@ -0,0 +1,197 @@
+package por
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Privately verifiable Shacham–Waters
+//
+// When the auditor is the data owner, authenticators can be MACs over the prime
+// field Z_p instead of RSA signatures:
+//
+//	sigma_i = f(i) + sum_j alpha_j m_ij  mod p
+//
+// where f and alpha are derived from a secret PRF key and the file name. A proof
+// is mu_j = sum v_i m_ij and sigma = sum v_i sigma_i (mod p), and the owner
+// checks sigma = sum v_i f(i) + sum alpha_j mu_j. Tagging and verification cost
+// a few hashes and field operations per block rather than RSA exponentiations.
+
+// privateModulus is p = 2^255 - 19.
+var privateModulus = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// DefaultPrivateParams fits 31-byte sectors below p.
+var DefaultPrivateParams = Params{S: 64, SectorSize: 31}
+
+// PrivateKey is the owner's secret: PRFKey derives f and alpha, MACKey
+// authenticates the tag.
+type PrivateKey struct {
+	PRFKey []byte
+	MACKey []byte
+}
+
+// PrivateTau is the tag of a file under a PrivateKey. The U vector of its
+// Tau_zero is unused.
+type PrivateTau struct {
+	Tau_zero
+	mac []byte
+}
+
+func PrivateKeygen() (*PrivateKey, error) {
+	key := &PrivateKey{PRFKey: make([]byte, 32), MACKey: make([]byte, 32)}
+	if _, err := rand.Read(key.PRFKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRandomness, err)
+	}
+	if _, err := rand.Read(key.MACKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRandomness, err)
+	}
+	return key, nil
+}
+
+// fieldElement is PRF(label, name, i) mapped into Z_p.
+func (key *PrivateKey) fieldElement(label string, name []byte, i int64) *big.Int {
+	mac := hmac.New(sha512.New, key.PRFKey)
+	mac.Write([]byte(label))
+	var k [8]byte
+	binary.BigEndian.PutUint64(k[:], uint64(len(name)))
+	mac.Write(k[:])
+	mac.Write(name)
+	binary.BigEndian.PutUint64(k[:], uint64(i))
+	mac.Write(k[:])
+	return new(big.Int).Mod(new(big.Int).SetBytes(mac.Sum(nil)), privateModulus)
+}
+
+func (key *PrivateKey) alphas(tau_zero Tau_zero) []*big.Int {
+	alpha := make([]*big.Int, tau_zero.S)
+	for j := range alpha {
+		alpha[j] = key.fieldElement("por-alpha", tau_zero.name, int64(j))
+	}
+	return alpha
+}
+
+func (key *PrivateKey) tagMAC(tau_zero Tau_zero) []byte {
+	mac := hmac.New(sha512.New, key.MACKey)
+	mac.Write([]byte("por-private-tag"))
+	mac.Write(tau_zero.signedBytes())
+	return mac.Sum(nil)
+}
+
+func (key *PrivateKey) verifyTag(tau PrivateTau) error {
+	if !hmac.Equal(key.tagMAC(tau.Tau_zero), tau.mac) {
+		return ErrBadTagSignature
+	}
+	return nil
+}
+
+// PrivateSt tags the blocks read from r like St, with MAC authenticators.
+func PrivateSt(ctx context.Context, key *PrivateKey, r io.Reader, params Params, sink AuthenticatorSink, opts StOptions) (PrivateTau, error) {
+	return privateSt(ctx, key, streamInput(r), params, sink, opts)
+}
+
+// PrivateStSource tags the file src like StSource, with MAC authenticators.
+func PrivateStSource(ctx context.Context, key *PrivateKey, src BlockSource, params Params, sink AuthenticatorSink, opts StOptions) (PrivateTau, error) {
+	return privateSt(ctx, key, sourceInput(src), params, sink, opts)
+}
+
+func privateSt(ctx context.Context, key *PrivateKey, input tagInput, params Params, sink AuthenticatorSink, opts StOptions) (PrivateTau, error) {
+	if err := params.check(privateModulus); err != nil {
+		return PrivateTau{}, err
+	}
+	tau_zero := Tau_zero{Params: params, name: make([]byte, 64)}
+	if _, err := rand.Read(tau_zero.name); err != nil {
+		return PrivateTau{}, fmt.Errorf("%w: %v", ErrRandomness, err)
+	}
+	alpha := key.alphas(tau_zero)
+
+	encoded, size, err := input(tau_zero.name, params, opts)
+	if err != nil {
+		return PrivateTau{}, err
+	}
+	n, err := tagBlocks(ctx, encoded, params.BlockSize(), sink, opts, func(i int64, piece []byte) *big.Int {
+		sigma := key.fieldElement("por-block", tau_zero.name, i+1)
+		for j := int64(0); j < params.S; j++ {
+			sigma.Add(sigma, new(big.Int).Mul(alpha[j], sector(piece, j, params.SectorSize)))
+		}
+		return sigma.Mod(sigma, privateModulus)
+	})
+	if err != nil {
+		return PrivateTau{}, err
+	}
+	tau_zero.n, tau_zero.size = n, size()
+	return PrivateTau{Tau_zero: tau_zero, mac: key.tagMAC(tau_zero)}, nil
+}
+
+// PrivateChallenge checks the tag and draws a fresh challenge sized by spec.
+func PrivateChallenge(key *PrivateKey, tau PrivateTau, spec ChallengeSpec) (Challenge, error) {
+	if err := key.verifyTag(tau); err != nil {
+		return Challenge{}, err
+	}
+	return newBoundChallenge(tau.Tau_zero, spec)
+}
+
+// PrivateProve answers ch; the prover needs no key.
+func PrivateProve(tau PrivateTau, ch Challenge, authenticators AuthenticatorSource, file BlockSource) (Proof, error) {
+	if err := checkBinding(ch, tau.Tau_zero); err != nil {
+		return Proof{}, err
+	}
+	q, err := ch.elements(tau.n)
+	if err != nil {
+		return Proof{}, err
+	}
+	mu, err := proveMu(file, tau.Params, tau.n, q, privateModulus)
+	if err != nil {
+		return Proof{}, err
+	}
+	sigma := big.NewInt(0)
+	for _, qelem := range q {
+		sigma_i, err := authenticators.Authenticator(qelem.I - 1)
+		if err != nil {
+			return Proof{}, err
+		}
+		sigma.Add(sigma, new(big.Int).Mul(big.NewInt(qelem.V), sigma_i))
+	}
+	sigma.Mod(sigma, privateModulus)
+	return Proof{Mu: mu, Sigma: sigma, Challenge: ch.answerDigest()}, nil
+}
+
+// PrivateVerify reports whether proof answers ch, with the same error
+// conventions as Verify_two.
+func PrivateVerify(key *PrivateKey, tau PrivateTau, ch Challenge, proof Proof) (bool, error) {
+	if err := key.verifyTag(tau); err != nil {
+		return false, err
+	}
+	if int64(len(proof.Mu)) != tau.S || proof.Sigma == nil {
+		return false, ErrMalformedProof
+	}
+	if err := checkAnswers(ch, tau.Tau_zero, proof.Challenge); err != nil {
+		return false, err
+	}
+	q, err := ch.elements(tau.n)
+	if err != nil {
+		return false, err
+	}
+
+	expected := big.NewInt(0)
+	for _, qelem := range q {
+		if qelem.I < 1 || qelem.I > tau.n {
+			return false, fmt.Errorf("%w: block %d of %d", ErrChallengeOutOfRange, qelem.I, tau.n)
+		}
+		f := key.fieldElement("por-block", tau.name, qelem.I)
+		expected.Add(expected, f.Mul(f, big.NewInt(qelem.V)))
+	}
+	for j, alpha := range key.alphas(tau.Tau_zero) {
+		mu := proof.Mu[j]
+		if mu == nil || mu.Sign() < 0 || mu.Cmp(privateModulus) >= 0 {
+			return false, ErrMalformedProof
+		}
+		expected.Add(expected, new(big.Int).Mul(alpha, mu))
+	}
+	expected.Mod(expected, privateModulus)
+	return expected.Cmp(proof.Sigma) == 0, nil
+}
@@ -0,0 +1,513 @@
+package por
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// Erasure coding
+//
+// A PoR only guarantees that a prover passing spot checks holds most of the
+// blocks, so the file is erasure coded before it is tagged: every group of
+// DataShards blocks gets ParityShards parity blocks of a systematic
+// Reed–Solomon code over GF(2^8), applied byte by byte across the blocks of the
+// group. Any DataShards blocks of a group are enough to rebuild it.
+//
+// Groups are small, so a prover that knew them could destroy the file by
+// dropping ParityShards+1 blocks of one group, which spot checks almost never
+// notice. As in Juels–Kaliski, the blocks of all groups are therefore shuffled
+// by a keyed permutation and encrypted under the owner's code key before they
+// are stored and tagged: the prover cannot tell which blocks share a group, so
+// its losses fall on the groups at random. The challenge then only has to
+// catch a loss large enough to break some group with fair probability, which
+// is how codeSpec sizes it.
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(2^8) with the
+// primitive polynomial x^8 + x^4 + x^3 + x^2 + 1.
+var gfExp, gfLog = func() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfMulAdd sets dst[x] ^= c * src[x].
+func gfMulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	logC := int(gfLog[c])
+	for x, v := range src {
+		if v != 0 {
+			dst[x] ^= gfExp[logC+int(gfLog[v])]
+		}
+	}
+}
+
+// rsCode is a systematic (k+m, k) code whose generator is the identity over
+// a k×m Cauchy matrix, so every k×k submatrix of the generator is invertible.
+type rsCode struct {
+	k, m   int
+	parity [][]byte
+}
+
+func newRSCode(k, m int) *rsCode {
+	parity := make([][]byte, m)
+	for r := range parity {
+		parity[r] = make([]byte, k)
+		for c := range parity[r] {
+			parity[r][c] = gfInv(byte(k+r) ^ byte(c))
+		}
+	}
+	return &rsCode{k: k, m: m, parity: parity}
+}
+
+// row returns row r of the generator matrix.
+func (c *rsCode) row(r int) []byte {
+	if r >= c.k {
+		return c.parity[r-c.k]
+	}
+	row := make([]byte, c.k)
+	row[r] = 1
+	return row
+}
+
+// reconstruct rebuilds the k data shards from shards, where missing shards
+// are nil. At least k shards must be present.
+func (c *rsCode) reconstruct(shards [][]byte) ([][]byte, error) {
+	rows := make([]int, 0, c.k)
+	for r, shard := range shards {
+		if shard != nil && len(rows) < c.k {
+			rows = append(rows, r)
+		}
+	}
+	if len(rows) < c.k {
+		return nil, ErrUnrecoverable
+	}
+
+	// invert the k×k submatrix of the generator picked by rows, by Gauss-Jordan
+	// elimination on [A | I]
+	a := make([][]byte, c.k)
+	inv := make([][]byte, c.k)
+	for x, r := range rows {
+		a[x] = append([]byte(nil), c.row(r)...)
+		inv[x] = make([]byte, c.k)
+		inv[x][x] = 1
+	}
+	for col := 0; col < c.k; col++ {
+		pivot := col
+		for pivot < c.k && a[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == c.k {
+			return nil, ErrUnrecoverable
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+		scale := gfInv(a[col][col])
+		for x := range a[col] {
+			a[col][x] = gfMul(a[col][x], scale)
+			inv[col][x] = gfMul(inv[col][x], scale)
+		}
+		for y := 0; y < c.k; y++ {
+			if y != col && a[y][col] != 0 {
+				f := a[y][col]
+				gfMulAdd(a[y], a[col], f)
+				gfMulAdd(inv[y], inv[col], f)
+			}
+		}
+	}
+
+	data := make([][]byte, c.k)
+	for x := range data {
+		data[x] = make([]byte, len(shards[rows[0]]))
+		for y, r := range rows {
+			gfMulAdd(data[x], shards[r], inv[x][y])
+		}
+	}
+	return data, nil
+}
+
+func (p Params) coded() bool {
+	return p.ParityShards > 0
+}
+
+func (p Params) checkCode() error {
+	if p.DataShards < 0 || p.ParityShards < 0 {
+		return fmt.Errorf("%w: shard counts must not be negative", ErrBadParams)
+	}
+	if p.coded() && (p.DataShards < 1 || p.DataShards+p.ParityShards > 256) {
+		return fmt.Errorf("%w: need 1 to 256 shards per group", ErrBadParams)
+	}
+	return nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	k, err := c.r.Read(p)
+	c.n += int64(k)
+	return k, err
+}
+
+// MinCodeKeySize is the shortest code key accepted for erasure coded files.
+const MinCodeKeySize = 16
+
+// CodeKeygen draws a fresh code key. The owner keeps it secret alongside the
+// signing key: it is needed again to extract the file.
+func CodeKeygen() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRandomness, err)
+	}
+	return key, nil
+}
+
+// blockPermutation is a keyed pseudorandom permutation of [0, n): a balanced
+// Feistel network over the smallest even number of bits covering n, walking
+// the cycle back into range.
+type blockPermutation struct {
+	n     uint64
+	half  uint
+	block cipher.Block
+}
+
+const feistelRounds = 8
+
+func newBlockPermutation(key []byte, n int64) (*blockPermutation, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	half := uint(bits.Len64(uint64(n-1))+1) / 2
+	if half == 0 {
+		half = 1
+	}
+	return &blockPermutation{n: uint64(n), half: half, block: block}, nil
+}
+
+func (p *blockPermutation) round(r int, x uint64) uint64 {
+	var in, out [aes.BlockSize]byte
+	in[0] = byte(r)
+	binary.BigEndian.PutUint64(in[8:], x)
+	p.block.Encrypt(out[:], in[:])
+	return binary.BigEndian.Uint64(out[:8]) & (1<<p.half - 1)
+}
+
+// forward returns the position of x.
+func (p *blockPermutation) forward(x int64) int64 {
+	y := uint64(x)
+	for {
+		l, r := y>>p.half, y&(1<<p.half-1)
+		for i := 0; i < feistelRounds; i++ {
+			l, r = r, l^p.round(i, r)
+		}
+		if y = l<<p.half | r; y < p.n {
+			return int64(y)
+		}
+	}
+}
+
+// backward returns the x at position y.
+func (p *blockPermutation) backward(y int64) int64 {
+	x := uint64(y)
+	for {
+		l, r := x>>p.half, x&(1<<p.half-1)
+		for i := feistelRounds - 1; i >= 0; i-- {
+			l, r = r^p.round(i, l), l
+		}
+		if x = l<<p.half | r; x < p.n {
+			return int64(x)
+		}
+	}
+}
+
+// fileCode is the erasure code of one file of size bytes under a code key:
+// symbol x of group g, numbered s = g*(DataShards+ParityShards) + x, is
+// stored as block perm.forward(s)+1, encrypted under blocks.
+type fileCode struct {
+	params Params
+	code   *rsCode
+	size   int64
+	n      int64
+	perm   *blockPermutation
+	blocks cipher.Block
+}
+
+// fileCodeKey derives the key of one use of a file code from the owner's
+// code key and the file name.
+func fileCodeKey(key, name []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	mac.Write(name)
+	return mac.Sum(nil)
+}
+
+func newFileCode(key, name []byte, params Params, size int64) (*fileCode, error) {
+	if len(key) < MinCodeKeySize {
+		return nil, fmt.Errorf("%w: erasure coding needs a code key of at least %d bytes", ErrBadParams, MinCodeKeySize)
+	}
+	blockSize := params.BlockSize()
+	k, group := params.DataShards, params.DataShards+params.ParityShards
+	data := (size + blockSize - 1) / blockSize
+	c := &fileCode{
+		params: params,
+		code:   newRSCode(int(params.DataShards), int(params.ParityShards)),
+		size:   size,
+		n:      (data + k - 1) / k * group,
+	}
+	if c.n == 0 {
+		return c, nil
+	}
+	var err error
+	if c.perm, err = newBlockPermutation(fileCodeKey(key, name, "por-code-permutation"), c.n); err != nil {
+		return nil, err
+	}
+	if c.blocks, err = aes.NewCipher(fileCodeKey(key, name, "por-code-cipher")); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// crypt encrypts or decrypts in place the block stored at position p (from 0).
+func (c *fileCode) crypt(block []byte, p int64) {
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv, uint64(p))
+	cipher.NewCTR(c.blocks, iv).XORKeyStream(block, block)
+}
+
+// dataBlock reads block d (from 0) of the original file, zero padded.
+func (c *fileCode) dataBlock(src BlockSource, d int64) ([]byte, error) {
+	blockSize := c.params.BlockSize()
+	piece := make([]byte, blockSize)
+	offset := d * blockSize
+	want := c.size - offset
+	if want <= 0 {
+		return piece, nil
+	}
+	if want > blockSize {
+		want = blockSize
+	}
+	k, err := src.ReadAt(piece[:want], offset)
+	if int64(k) == want {
+		return piece, nil
+	}
+	if err == nil || err == io.EOF {
+		return nil, fmt.Errorf("%w: block %d", ErrShortRead, d+1)
+	}
+	return nil, err
+}
+
+// symbol computes symbol s of the codewords from the original file.
+func (c *fileCode) symbol(src BlockSource, s int64) ([]byte, error) {
+	k, group := c.params.DataShards, c.params.DataShards+c.params.ParityShards
+	g, x := s/group, s%group
+	if x < k {
+		return c.dataBlock(src, g*k+x)
+	}
+	parity := make([]byte, c.params.BlockSize())
+	for col := int64(0); col < k; col++ {
+		shard, err := c.dataBlock(src, g*k+col)
+		if err != nil {
+			return nil, err
+		}
+		gfMulAdd(parity, shard, c.code.parity[x-k][col])
+	}
+	return parity, nil
+}
+
+// erasureReader yields the stored blocks of a file code in order. Each block
+// is computed from the original file on demand, so parity blocks read their
+// whole group.
+type erasureReader struct {
+	src  BlockSource
+	code *fileCode
+	next int64
+	buf  []byte
+}
+
+func (e *erasureReader) Read(p []byte) (int, error) {
+	if len(e.buf) == 0 {
+		if e.next == e.code.n {
+			return 0, io.EOF
+		}
+		block, err := e.code.symbol(e.src, e.code.perm.backward(e.next))
+		if err != nil {
+			return 0, err
+		}
+		e.code.crypt(block, e.next)
+		e.buf = block
+		e.next++
+	}
+	k := copy(p, e.buf)
+	e.buf = e.buf[k:]
+	return k, nil
+}
+
+// Extract writes the original file to w from src, a stored copy of the
+// encoded file in which the blocks listed in bad (numbered from 1) are known
+// to be corrupt. Blocks that cannot be read are treated as corrupt too. An
+// erasure coded file is decoded with the code key it was tagged with; any
+// other key yields garbage. It fails with ErrUnrecoverable when a group has
+// lost more than ParityShards blocks, or when the file is not erasure coded
+// and any block is bad; the rest of src is still read, but nothing past the
+// first lost group is written.
+func (t Tau_zero) Extract(codeKey []byte, src BlockSource, bad []int64, w io.Writer) error {
+	if err := t.checkCode(); err != nil {
+		return err
+	}
+	isBad := make(map[int64]bool, len(bad))
+	for _, i := range bad {
+		isBad[i] = true
+	}
+
+	k, group := int64(1), int64(1)
+	var code *fileCode
+	if t.coded() {
+		k, group = t.DataShards, t.DataShards+t.ParityShards
+		var err error
+		if code, err = newFileCode(codeKey, t.name, t.Params, t.size); err != nil {
+			return err
+		}
+		if code.n != t.n {
+			return fmt.Errorf("%w: tag covers %d blocks, the code of %d bytes %d", ErrUnrecoverable, t.n, t.size, code.n)
+		}
+	}
+	remaining := t.size
+	var lost error
+	for first := int64(0); first < t.n && remaining > 0; first += group {
+		shards := make([][]byte, group)
+		missing := false
+		for x := int64(0); x < group && first+x < t.n; x++ {
+			p := first + x
+			if code != nil {
+				p = code.perm.forward(p)
+			}
+			if isBad[p+1] {
+				missing = missing || x < k
+				continue
+			}
+			piece, err := readBlockAt(src, t.Params, t.n, p+1)
+			if err != nil {
+				missing = missing || x < k
+				continue
+			}
+			if code != nil {
+				code.crypt(piece, p)
+			}
+			shards[x] = piece
+		}
+
+		data := shards[:k]
+		if missing && lost == nil {
+			if code == nil {
+				lost = fmt.Errorf("%w: block %d", ErrUnrecoverable, first+1)
+			} else if rebuilt, err := code.code.reconstruct(shards); err != nil {
+				lost = fmt.Errorf("%w: group %d", err, first/group+1)
+			} else {
+				data = rebuilt
+			}
+		}
+		for _, shard := range data {
+			size := t.BlockSize()
+			if size > remaining {
+				size = remaining
+			}
+			if lost == nil {
+				if _, err := w.Write(shard[:size]); err != nil {
+					return err
+				}
+			}
+			remaining -= size
+			if remaining == 0 {
+				break
+			}
+		}
+	}
+	if lost != nil {
+		return lost
+	}
+	if remaining > 0 {
+		return fmt.Errorf("%w: tag covers fewer blocks than the file size", ErrUnrecoverable)
+	}
+	return nil
+}
+
+// tolerableCorruption returns the largest fraction e of blocks a prover can
+// lose while the file stays recoverable with probability at least detection.
+// The prover cannot tell which blocks share a group, so a group of w =
+// DataShards+ParityShards blocks loses j of them with probability about
+// C(w, j) e^j (1-e)^(w-j), and the file is lost when any group loses more
+// than ParityShards.
+func (t Tau_zero) tolerableCorruption(detection float64) float64 {
+	w, m := t.DataShards+t.ParityShards, t.ParityShards
+	groups := float64(t.n / w)
+	lost := func(e float64) float64 {
+		lw, _ := math.Lgamma(float64(w + 1))
+		p := 0.0
+		for j := m + 1; j <= w; j++ {
+			lj, _ := math.Lgamma(float64(j + 1))
+			lr, _ := math.Lgamma(float64(w - j + 1))
+			p += math.Exp(lw - lj - lr + float64(j)*math.Log(e) + float64(w-j)*math.Log1p(-e))
+		}
+		return groups * p
+	}
+	lo, hi := 0.0, 1.0
+	for i := 0; i < 64; i++ {
+		if mid := (lo + hi) / 2; lost(mid) <= 1-detection {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// codeSpec returns spec for the file t describes. The Corruption of an
+// erasure coded file follows from its code instead (see tolerableCorruption):
+// a prover that lost fewer blocks still holds a recoverable file, and one
+// that lost more is caught with probability Detection.
+func (t Tau_zero) codeSpec(spec ChallengeSpec) ChallengeSpec {
+	if !t.coded() || spec.L > 0 || spec.Detection <= 0 || spec.Detection > 1 || t.n < 1 {
+		return spec
+	}
+	spec.Corruption = t.tolerableCorruption(spec.Detection)
+	if least := 1 / float64(t.n); spec.Corruption < least {
+		spec.Corruption = least
+	}
+	return spec
+}
@@ -0,0 +1,202 @@
+package por
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestBlockPermutation(t *testing.T) {
+	key := bytes.Repeat([]byte{3}, 32)
+	for _, n := range []int64{1, 2, 3, 4, 5, 6, 17, 64, 255, 1000, 4097} {
+		p, err := newBlockPermutation(key, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := make(map[int64]bool, n)
+		for x := int64(0); x < n; x++ {
+			y := p.forward(x)
+			if y < 0 || y >= n || seen[y] {
+				t.Fatalf("n = %d: forward(%d) = %d is out of range or repeated", n, x, y)
+			}
+			seen[y] = true
+			if back := p.backward(y); back != x {
+				t.Fatalf("n = %d: backward(forward(%d)) = %d", n, x, back)
+			}
+		}
+	}
+}
+
+// parityShards encodes data under c.
+func parityShards(c *rsCode, data [][]byte) [][]byte {
+	parity := make([][]byte, c.m)
+	for r := range parity {
+		parity[r] = make([]byte, len(data[0]))
+		for col, shard := range data {
+			gfMulAdd(parity[r], shard, c.parity[r][col])
+		}
+	}
+	return parity
+}
+
+func TestReconstruct(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, shape := range []struct{ k, m int }{{1, 1}, {4, 2}, {10, 4}, {200, 56}} {
+		c := newRSCode(shape.k, shape.m)
+		data := make([][]byte, shape.k)
+		for x := range data {
+			data[x] = make([]byte, 64)
+			rng.Read(data[x])
+		}
+		codeword := append(append([][]byte(nil), data...), parityShards(c, data)...)
+		for trial := 0; trial < 4; trial++ {
+			for lost := 0; lost <= shape.m+1; lost++ {
+				shards := append([][]byte(nil), codeword...)
+				for _, x := range rng.Perm(len(shards))[:lost] {
+					shards[x] = nil
+				}
+				rebuilt, err := c.reconstruct(shards)
+				if lost > shape.m {
+					if !errors.Is(err, ErrUnrecoverable) {
+						t.Fatalf("%+v: %d lost shards: got %v", shape, lost, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%+v: %d lost shards: %v", shape, lost, err)
+				}
+				for x := range data {
+					if !bytes.Equal(rebuilt[x], data[x]) {
+						t.Fatalf("%+v: %d lost shards: data shard %d differs", shape, lost, x)
+					}
+				}
+			}
+		}
+	}
+}
+
+// testCoded tags a random file with a 4+2 code.
+func testCoded(t *testing.T, codeKey []byte) (Tau, Authenticators, []byte, []byte) {
+	t.Helper()
+	_, ssk := testKeys(t)
+	params := testParams
+	params.DataShards, params.ParityShards = 4, 2
+	data := testFile(t, 23)
+	var authenticators Authenticators
+	var encoded bytes.Buffer
+	tau, err := StSource(context.Background(), ssk, BytesSource(data), params, &authenticators, StOptions{CodeKey: codeKey, Encoded: &encoded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tau, authenticators, data, encoded.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	codeKey, err := CodeKeygen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tau, _, data, stored := testCoded(t, codeKey)
+	if tau.Blocks() != 36 || int64(len(stored)) != tau.Blocks()*tau.BlockSize() {
+		t.Fatalf("%d blocks stored in %d bytes", tau.Blocks(), len(stored))
+	}
+	for i := int64(0); i < int64(len(data))/tau.BlockSize(); i++ {
+		if bytes.Contains(stored, data[i*tau.BlockSize():(i+1)*tau.BlockSize()]) {
+			t.Fatalf("block %d is stored in the clear", i+1)
+		}
+	}
+
+	code, err := newFileCode(codeKey, tau.name, tau.Params, tau.size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := tau.DataShards + tau.ParityShards
+	rng := rand.New(rand.NewSource(2))
+	for lost := int64(0); lost <= tau.ParityShards; lost++ {
+		// lose lost blocks of every group, at the positions they were shuffled to
+		var bad []int64
+		for first := int64(0); first < tau.Blocks(); first += group {
+			for _, x := range rng.Perm(int(group))[:lost] {
+				bad = append(bad, code.perm.forward(first+int64(x))+1)
+			}
+		}
+		var out bytes.Buffer
+		if err := tau.Extract(codeKey, BytesSource(stored), bad, &out); err != nil {
+			t.Fatalf("%d lost blocks per group: %v", lost, err)
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Fatalf("%d lost blocks per group: extracted another file", lost)
+		}
+	}
+
+	var bad []int64
+	for x := int64(0); x <= tau.ParityShards; x++ {
+		bad = append(bad, code.perm.forward(group+x)+1)
+	}
+	if err := tau.Extract(codeKey, BytesSource(stored), bad, new(bytes.Buffer)); !errors.Is(err, ErrUnrecoverable) {
+		t.Fatalf("%d lost blocks in a group: got %v", len(bad), err)
+	}
+
+	other, err := CodeKeygen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := tau.Extract(other, BytesSource(stored), nil, &out); err == nil && bytes.Equal(out.Bytes(), data) {
+		t.Fatal("another code key decoded the file")
+	}
+	if err := tau.Extract(nil, BytesSource(stored), nil, &out); !errors.Is(err, ErrBadParams) {
+		t.Fatalf("no code key: got %v", err)
+	}
+}
+
+func TestCodedProofVerifies(t *testing.T) {
+	spk, _ := testKeys(t)
+	codeKey, err := CodeKeygen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tau, authenticators, _, stored := testCoded(t, codeKey)
+	ch, err := Verify_one(tau, spk, DefaultChallengeSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := Prove(tau, ch, authenticators, spk, BytesSource(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Verify_two(tau, ch, proof, spk); !ok || err != nil {
+		t.Fatalf("proof over the coded file rejected: %v", err)
+	}
+}
+
+func TestStRejectsCodedStream(t *testing.T) {
+	_, ssk := testKeys(t)
+	params := testParams
+	params.DataShards, params.ParityShards = 4, 2
+	_, err := St(context.Background(), ssk, bytes.NewReader(testFile(t, 3)), params, new(Authenticators), StOptions{CodeKey: make([]byte, 32)})
+	if !errors.Is(err, ErrBadParams) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestCodeSpec(t *testing.T) {
+	for _, c := range []struct{ k, m, n int64 }{{4, 2, 600000}, {10, 4, 6000}, {223, 32, 600000}} {
+		tau := Tau_zero{Params: Params{DataShards: c.k, ParityShards: c.m}, n: c.n}
+		spec := tau.codeSpec(DefaultChallengeSpec)
+		// losing spec.Corruption of the blocks at random must leave every group
+		// recoverable with probability Detection
+		if e := spec.Corruption; e <= 0 || e >= float64(c.m)/float64(c.k+c.m) {
+			t.Fatalf("%+v: corruption %g", c, e)
+		}
+		if tau.tolerableCorruption(0.999) >= spec.Corruption {
+			t.Fatalf("%+v: a higher detection target tolerates as much corruption", c)
+		}
+	}
+	uncoded := Tau_zero{n: 1000}
+	if spec := uncoded.codeSpec(DefaultChallengeSpec); spec != DefaultChallengeSpec {
+		t.Fatalf("uncoded spec changed to %+v", spec)
+	}
+}
@@ -0,0 +1,137 @@
+package por
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+)
+
+// Retrieval
+//
+// The verifier recovers a file by fetching every block together with its
+// authenticator and checking each one on its own. Blocks that fail the check,
+// or cannot be fetched, are treated as erasures and rebuilt from the parity
+// blocks when the file was erasure coded.
+
+// BlockFetcher returns block i (numbered from 1) of a tagged file and its
+// authenticator; the verifier talks to the prover through it.
+type BlockFetcher interface {
+	FetchBlock(i int64) ([]byte, *big.Int, error)
+}
+
+// FileFetcher serves blocks from a prover's local copy.
+type FileFetcher struct {
+	Params         Params
+	Blocks         int64
+	Authenticators AuthenticatorSource
+	File           BlockSource
+}
+
+func (f FileFetcher) FetchBlock(i int64) ([]byte, *big.Int, error) {
+	block, err := readBlockAt(f.File, f.Params, f.Blocks, i)
+	if err != nil {
+		return nil, nil, err
+	}
+	sigma, err := f.Authenticators.Authenticator(i - 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, sigma, nil
+}
+
+// CheckBlock reports whether sigma is the authenticator of block i under tau:
+// sigma^e = H(name, i) * prod_j u_j^m_ij mod N.
+func CheckBlock(tau Tau, spk *rsa.PublicKey, i int64, block []byte, sigma *big.Int) bool {
+	if int64(len(block)) != tau.BlockSize() || int64(len(tau.U)) != tau.S || sigma == nil {
+		return false
+	}
+	expected := hashNameI(tau.name, i)
+	for j := int64(0); j < tau.S; j++ {
+		expected.Mul(expected, new(big.Int).Exp(&tau.U[j], sector(block, j, tau.SectorSize), spk.N))
+		expected.Mod(expected, spk.N)
+	}
+	return expected.Cmp(new(big.Int).Exp(sigma, big.NewInt(int64(spk.E)), spk.N)) == 0
+}
+
+// CheckPrivateBlock is CheckBlock for the privately verifiable scheme.
+func CheckPrivateBlock(key *PrivateKey, tau PrivateTau, i int64, block []byte, sigma *big.Int) bool {
+	if int64(len(block)) != tau.BlockSize() || sigma == nil {
+		return false
+	}
+	expected := key.fieldElement("por-block", tau.name, i)
+	for j, alpha := range key.alphas(tau.Tau_zero) {
+		expected.Add(expected, new(big.Int).Mul(alpha, sector(block, int64(j), tau.SectorSize)))
+	}
+	return expected.Mod(expected, privateModulus).Cmp(sigma) == 0
+}
+
+// RetrieveReport lists the blocks that were fetched and the ones that failed
+// their authenticator check or could not be fetched.
+type RetrieveReport struct {
+	Fetched int64
+	Failed  []int64
+}
+
+// checkedSource is the BlockSource that Extract reads the file through: every
+// block is fetched and checked on first access.
+type checkedSource struct {
+	params  Params
+	blocks  int64
+	fetcher BlockFetcher
+	check   func(i int64, block []byte, sigma *big.Int) bool
+	report  *RetrieveReport
+}
+
+func (c *checkedSource) Size() int64 {
+	return c.blocks * c.params.BlockSize()
+}
+
+func (c *checkedSource) ReadAt(p []byte, off int64) (int, error) {
+	blockSize := c.params.BlockSize()
+	if off%blockSize != 0 || int64(len(p)) != blockSize {
+		return 0, fmt.Errorf("por: unaligned read at %d", off)
+	}
+	i := off/blockSize + 1
+	c.report.Fetched++
+	block, sigma, err := c.fetcher.FetchBlock(i)
+	if err != nil || !c.check(i, block, sigma) {
+		c.report.Failed = append(c.report.Failed, i)
+		return 0, fmt.Errorf("%w: block %d", ErrMalformedProof, i)
+	}
+	return copy(p, block), nil
+}
+
+func retrieve(tau_zero Tau_zero, codeKey []byte, fetcher BlockFetcher, check func(i int64, block []byte, sigma *big.Int) bool, w io.Writer) (RetrieveReport, error) {
+	var report RetrieveReport
+	src := &checkedSource{params: tau_zero.Params, blocks: tau_zero.n, fetcher: fetcher, check: check, report: &report}
+	err := tau_zero.Extract(codeKey, src, nil, w)
+	sort.Slice(report.Failed, func(a, b int) bool { return report.Failed[a] < report.Failed[b] })
+	return report, err
+}
+
+// Retrieve fetches every block of the file tagged by tau, checks it against
+// its authenticator and writes the recovered file to w, decoding an erasure
+// coded file with codeKey, the key it was tagged with. The report lists the
+// blocks that failed even when the file could be rebuilt; the error is
+// ErrUnrecoverable when too many blocks were lost, and every block is still
+// fetched so that the report lists all failures.
+func Retrieve(tau Tau, spk *rsa.PublicKey, codeKey []byte, fetcher BlockFetcher, w io.Writer) (RetrieveReport, error) {
+	if err := verifyTag(tau, spk); err != nil {
+		return RetrieveReport{}, err
+	}
+	return retrieve(tau.Tau_zero, codeKey, fetcher, func(i int64, block []byte, sigma *big.Int) bool {
+		return CheckBlock(tau, spk, i, block, sigma)
+	}, w)
+}
+
+// PrivateRetrieve is Retrieve for the privately verifiable scheme.
+func PrivateRetrieve(key *PrivateKey, tau PrivateTau, codeKey []byte, fetcher BlockFetcher, w io.Writer) (RetrieveReport, error) {
+	if err := key.verifyTag(tau); err != nil {
+		return RetrieveReport{}, err
+	}
+	return retrieve(tau.Tau_zero, codeKey, fetcher, func(i int64, block []byte, sigma *big.Int) bool {
+		return CheckPrivateBlock(key, tau, i, block, sigma)
+	}, w)
+}
@@ -0,0 +1,60 @@
+package por
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// corrupt returns a copy of stored with one byte flipped in each of blocks.
+func corrupt(stored []byte, blockSize int64, blocks ...int64) []byte {
+	out := append([]byte(nil), stored...)
+	for _, i := range blocks {
+		out[(i-1)*blockSize] ^= 0xff
+	}
+	return out
+}
+
+func TestRetrieveReportsEveryFailure(t *testing.T) {
+	spk, _ := testKeys(t)
+	tau, authenticators, data := testTag(t)
+	stored := corrupt(data, tau.BlockSize(), 2, 5)
+	fetcher := FileFetcher{Params: tau.Params, Blocks: tau.Blocks(), Authenticators: authenticators, File: BytesSource(stored)}
+	report, err := Retrieve(tau, spk, nil, fetcher, new(bytes.Buffer))
+	if !errors.Is(err, ErrUnrecoverable) {
+		t.Fatalf("got %v", err)
+	}
+	if report.Fetched != tau.Blocks() || !reflect.DeepEqual(report.Failed, []int64{2, 5}) {
+		t.Fatalf("report %+v", report)
+	}
+
+	var out bytes.Buffer
+	fetcher.File = BytesSource(data)
+	if report, err := Retrieve(tau, spk, nil, fetcher, &out); err != nil || len(report.Failed) != 0 || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("intact file: report %+v, %v", report, err)
+	}
+}
+
+func TestRetrieveCoded(t *testing.T) {
+	spk, _ := testKeys(t)
+	codeKey, err := CodeKeygen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tau, authenticators, data, stored := testCoded(t, codeKey)
+	stored = corrupt(stored, tau.BlockSize(), 3, 17)
+	fetcher := FileFetcher{Params: tau.Params, Blocks: tau.Blocks(), Authenticators: authenticators, File: BytesSource(stored)}
+	var out bytes.Buffer
+	// two lost blocks never exceed the two parity blocks of a group
+	report, err := Retrieve(tau, spk, codeKey, fetcher, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Failed, []int64{3, 17}) {
+		t.Fatalf("report %+v", report)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("retrieved another file")
+	}
+}
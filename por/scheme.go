@@ -0,0 +1,222 @@
+package por
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Tag is the public per-file state of a scheme, such as a Tau or a PrivateTau.
+type Tag interface {
+	Name() []byte
+	Blocks() int64
+	MarshalBinary() ([]byte, error)
+}
+
+// Keys holds the keys of one storer under a scheme. Secret tags files, Prover
+// is what a prover needs to answer challenges (nil if nothing) and Verifier
+// checks proofs. For a privately verifiable scheme Verifier is the secret.
+type Keys struct {
+	Secret   interface{}
+	Prover   interface{}
+	Verifier interface{}
+}
+
+// Scheme is a proof-of-retrievability construction. Keys and tags handed to a
+// scheme must come from the same scheme, or ErrSchemeMismatch is returned.
+type Scheme interface {
+	Name() string
+	DefaultParams() Params
+	KeyGen() (Keys, error)
+	Tag(ctx context.Context, secret interface{}, r io.Reader, params Params, sink AuthenticatorSink, opts StOptions) (Tag, error)
+	UnmarshalTag(data []byte) (Tag, error)
+	Challenge(verifier interface{}, tag Tag, spec ChallengeSpec) (Challenge, error)
+	Prove(prover interface{}, tag Tag, ch Challenge, authenticators AuthenticatorSource, file BlockSource) (Proof, error)
+	Verify(verifier interface{}, tag Tag, ch Challenge, proof Proof) (bool, error)
+}
+
+const (
+	SchemeRSA     = "sw-rsa"
+	SchemePrivate = "sw-prf"
+)
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = make(map[string]Scheme)
+)
+
+func init() {
+	Register(rsaScheme{})
+	Register(privateScheme{})
+}
+
+// Register makes a scheme available by name. Like database/sql, it panics
+// when the name is taken, since that is a programming error.
+func Register(s Scheme) {
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+	if _, dup := schemes[s.Name()]; dup {
+		panic("por: Register called twice for scheme " + s.Name())
+	}
+	schemes[s.Name()] = s
+}
+
+func Lookup(name string) (Scheme, error) {
+	schemesMu.RLock()
+	defer schemesMu.RUnlock()
+	s, ok := schemes[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownScheme, name)
+	}
+	return s, nil
+}
+
+// Schemes returns the sorted names of the registered schemes.
+func Schemes() []string {
+	schemesMu.RLock()
+	defer schemesMu.RUnlock()
+	names := make([]string, 0, len(schemes))
+	for name := range schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rsaScheme is the publicly verifiable RSA construction of St, Verify_one,
+// Prove and Verify_two.
+type rsaScheme struct{}
+
+func (rsaScheme) Name() string          { return SchemeRSA }
+func (rsaScheme) DefaultParams() Params { return DefaultParams }
+
+func (rsaScheme) KeyGen() (Keys, error) {
+	spk, ssk, err := Keygen(DefaultKeyBits)
+	if err != nil {
+		return Keys{}, err
+	}
+	return Keys{Secret: ssk, Prover: spk, Verifier: spk}, nil
+}
+
+func (rsaScheme) Tag(ctx context.Context, secret interface{}, r io.Reader, params Params, sink AuthenticatorSink, opts StOptions) (Tag, error) {
+	ssk, ok := secret.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrSchemeMismatch
+	}
+	tau, err := St(ctx, ssk, r, params, sink, opts)
+	if err != nil {
+		return nil, err
+	}
+	return tau, nil
+}
+
+func (rsaScheme) UnmarshalTag(data []byte) (Tag, error) {
+	var tau Tau
+	if err := tau.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return tau, nil
+}
+
+func rsaArgs(key interface{}, tag Tag) (*rsa.PublicKey, Tau, error) {
+	spk, ok := key.(*rsa.PublicKey)
+	tau, isTau := tag.(Tau)
+	if !ok || !isTau {
+		return nil, Tau{}, ErrSchemeMismatch
+	}
+	return spk, tau, nil
+}
+
+func (rsaScheme) Challenge(verifier interface{}, tag Tag, spec ChallengeSpec) (Challenge, error) {
+	spk, tau, err := rsaArgs(verifier, tag)
+	if err != nil {
+		return Challenge{}, err
+	}
+	return Verify_one(tau, spk, spec)
+}
+
+func (rsaScheme) Prove(prover interface{}, tag Tag, ch Challenge, authenticators AuthenticatorSource, file BlockSource) (Proof, error) {
+	spk, tau, err := rsaArgs(prover, tag)
+	if err != nil {
+		return Proof{}, err
+	}
+	return Prove(tau, ch, authenticators, spk, file)
+}
+
+func (rsaScheme) Verify(verifier interface{}, tag Tag, ch Challenge, proof Proof) (bool, error) {
+	spk, tau, err := rsaArgs(verifier, tag)
+	if err != nil {
+		return false, err
+	}
+	return Verify_two(tau, ch, proof, spk)
+}
+
+// privateScheme is the MAC-based construction of PrivateSt and friends.
+type privateScheme struct{}
+
+func (privateScheme) Name() string          { return SchemePrivate }
+func (privateScheme) DefaultParams() Params { return DefaultPrivateParams }
+
+func (privateScheme) KeyGen() (Keys, error) {
+	key, err := PrivateKeygen()
+	if err != nil {
+		return Keys{}, err
+	}
+	return Keys{Secret: key, Verifier: key}, nil
+}
+
+func (privateScheme) Tag(ctx context.Context, secret interface{}, r io.Reader, params Params, sink AuthenticatorSink, opts StOptions) (Tag, error) {
+	key, ok := secret.(*PrivateKey)
+	if !ok {
+		return nil, ErrSchemeMismatch
+	}
+	tau, err := PrivateSt(ctx, key, r, params, sink, opts)
+	if err != nil {
+		return nil, err
+	}
+	return tau, nil
+}
+
+func (privateScheme) UnmarshalTag(data []byte) (Tag, error) {
+	var tau PrivateTau
+	if err := tau.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return tau, nil
+}
+
+func privateArgs(key interface{}, tag Tag) (*PrivateKey, PrivateTau, error) {
+	k, ok := key.(*PrivateKey)
+	tau, isTau := tag.(PrivateTau)
+	if !ok || !isTau {
+		return nil, PrivateTau{}, ErrSchemeMismatch
+	}
+	return k, tau, nil
+}
+
+func (privateScheme) Challenge(verifier interface{}, tag Tag, spec ChallengeSpec) (Challenge, error) {
+	key, tau, err := privateArgs(verifier, tag)
+	if err != nil {
+		return Challenge{}, err
+	}
+	return PrivateChallenge(key, tau, spec)
+}
+
+func (privateScheme) Prove(prover interface{}, tag Tag, ch Challenge, authenticators AuthenticatorSource, file BlockSource) (Proof, error) {
+	tau, ok := tag.(PrivateTau)
+	if !ok {
+		return Proof{}, ErrSchemeMismatch
+	}
+	return PrivateProve(tau, ch, authenticators, file)
+}
+
+func (privateScheme) Verify(verifier interface{}, tag Tag, ch Challenge, proof Proof) (bool, error) {
+	key, tau, err := privateArgs(verifier, tag)
+	if err != nil {
+		return false, err
+	}
+	return PrivateVerify(key, tau, ch, proof)
+}
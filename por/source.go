@@ -0,0 +1,49 @@
+package por
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// BlockSource is the stored copy of a tagged file that proofs, extraction and
+// retrieval read blocks from. Blocks are read with ReadAt only, so one source
+// can serve concurrent proofs.
+type BlockSource interface {
+	io.ReaderAt
+	Size() int64
+}
+
+type fileSource struct {
+	file *os.File
+	size int64
+}
+
+func (f fileSource) ReadAt(p []byte, off int64) (int, error) {
+	return f.file.ReadAt(p, off)
+}
+
+func (f fileSource) Size() int64 {
+	return f.size
+}
+
+// FileSource returns a BlockSource over file with its current size. It never
+// moves the file offset.
+func FileSource(file *os.File) (BlockSource, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return fileSource{file: file, size: info.Size()}, nil
+}
+
+// BytesSource returns a BlockSource over an in-memory copy of a file.
+func BytesSource(data []byte) BlockSource {
+	return bytes.NewReader(data)
+}
+
+// SectionSource returns a BlockSource over the n bytes of r starting at off,
+// such as one object among many in a larger file or remote store.
+func SectionSource(r io.ReaderAt, off, n int64) BlockSource {
+	return io.NewSectionReader(r, off, n)
+}
@@ -0,0 +1,191 @@
+package por
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Authenticator store
+//
+// An AuthenticatorStore keeps the authenticators of a file on disk so that
+// Prove reads only the challenged ones. The file is a fixed header followed by
+// one entry per block:
+//
+//	"PORS" ver | key fingerprint [32] | n u64 | width u32 | n × sigma_i [width]
+//
+// The fingerprint is the SHA-256 of the PKIX encoding of the public key, width
+// is the byte length of its modulus, and every sigma_i is big-endian, left
+// padded with zeros to width bytes. An all-zero entry marks a block with no
+// authenticator yet.
+
+var storeMagic = []byte("PORS")
+
+const storeHeaderSize = 4 + 1 + sha256.Size + 8 + 4
+
+// KeyFingerprint returns the SHA-256 of the PKIX encoding of spk.
+func KeyFingerprint(spk *rsa.PublicKey) ([sha256.Size]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(spk)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(der), nil
+}
+
+// AuthenticatorStore is an AuthenticatorSink and an AuthenticatorSource
+// backed by a file. It must be closed to record the block count.
+type AuthenticatorStore struct {
+	file        *os.File
+	fingerprint [sha256.Size]byte
+	n           int64
+	width       int64
+	writable    bool
+}
+
+// CreateAuthenticatorStore creates an empty store at path for authenticators
+// under spk, truncating any existing file.
+func CreateAuthenticatorStore(path string, spk *rsa.PublicKey) (*AuthenticatorStore, error) {
+	fingerprint, err := KeyFingerprint(spk)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &AuthenticatorStore{file: file, fingerprint: fingerprint, width: int64(spk.Size()), writable: true}
+	if err := s.writeHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenAuthenticatorStore opens the store at path for reading and checks that it
+// holds authenticators under spk.
+func OpenAuthenticatorStore(path string, spk *rsa.PublicKey) (*AuthenticatorStore, error) {
+	fingerprint, err := KeyFingerprint(spk)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := readStoreHeader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if s.fingerprint != fingerprint || s.width != int64(spk.Size()) {
+		file.Close()
+		return nil, ErrKeyMismatch
+	}
+	return s, nil
+}
+
+func readStoreHeader(file *os.File) (*AuthenticatorStore, error) {
+	header := make([]byte, storeHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("%w: authenticator store header: %v", ErrBadEncoding, err)
+	}
+	if !bytes.Equal(header[:4], storeMagic) {
+		return nil, fmt.Errorf("%w: bad magic", ErrBadEncoding)
+	}
+	if header[4] != encodingVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrBadEncoding, header[4])
+	}
+	s := &AuthenticatorStore{file: file}
+	copy(s.fingerprint[:], header[5:5+sha256.Size])
+	n := binary.BigEndian.Uint64(header[5+sha256.Size:])
+	s.width = int64(binary.BigEndian.Uint32(header[13+sha256.Size:]))
+	if s.width < 1 || n > 1<<62/uint64(s.width) {
+		return nil, fmt.Errorf("%w: bad authenticator store header", ErrBadEncoding)
+	}
+	s.n = int64(n)
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < storeHeaderSize+s.n*s.width {
+		return nil, fmt.Errorf("%w: authenticator store holds fewer than %d entries", ErrShortRead, s.n)
+	}
+	return s, nil
+}
+
+func (s *AuthenticatorStore) writeHeader() error {
+	header := make([]byte, storeHeaderSize)
+	copy(header, storeMagic)
+	header[4] = encodingVersion
+	copy(header[5:], s.fingerprint[:])
+	binary.BigEndian.PutUint64(header[5+sha256.Size:], uint64(s.n))
+	binary.BigEndian.PutUint32(header[13+sha256.Size:], uint32(s.width))
+	_, err := s.file.WriteAt(header, 0)
+	return err
+}
+
+// Put writes the authenticator of block i (numbered from 0).
+func (s *AuthenticatorStore) Put(i int64, sigma *big.Int) error {
+	if !s.writable {
+		return fmt.Errorf("%w: authenticator store is read only", ErrBadParams)
+	}
+	if i < 0 || sigma == nil || sigma.Sign() <= 0 || int64(len(sigma.Bytes())) > s.width {
+		return fmt.Errorf("%w: authenticator %d does not fit the store", ErrBadParams, i)
+	}
+	entry := make([]byte, s.width)
+	sigma.FillBytes(entry)
+	if _, err := s.file.WriteAt(entry, storeHeaderSize+i*s.width); err != nil {
+		return err
+	}
+	if i >= s.n {
+		s.n = i + 1
+	}
+	return nil
+}
+
+// Authenticator reads the authenticator of block i (numbered from 0).
+func (s *AuthenticatorStore) Authenticator(i int64) (*big.Int, error) {
+	if i < 0 || i >= s.n {
+		return nil, fmt.Errorf("%w: no authenticator for block %d", ErrChallengeOutOfRange, i+1)
+	}
+	entry := make([]byte, s.width)
+	if _, err := s.file.ReadAt(entry, storeHeaderSize+i*s.width); err != nil {
+		return nil, fmt.Errorf("%w: authenticator %d: %v", ErrShortRead, i+1, err)
+	}
+	sigma := new(big.Int).SetBytes(entry)
+	if sigma.Sign() == 0 {
+		return nil, fmt.Errorf("%w: no authenticator for block %d", ErrChallengeOutOfRange, i+1)
+	}
+	return sigma, nil
+}
+
+// Len returns the number of entries in the store.
+func (s *AuthenticatorStore) Len() int64 {
+	return s.n
+}
+
+// Fingerprint returns the fingerprint of the key the store belongs to.
+func (s *AuthenticatorStore) Fingerprint() [sha256.Size]byte {
+	return s.fingerprint
+}
+
+// Close records the block count, when the store was created for writing, and
+// closes the file.
+func (s *AuthenticatorStore) Close() error {
+	var err error
+	if s.writable {
+		if err = s.writeHeader(); err == nil {
+			err = s.file.Sync()
+		}
+	}
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}